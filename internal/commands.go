@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Name of the command line application.
+const appName = "up"
+
+// Command is a subcommand of the command line application.
+type Command struct {
+	Name string
+	// One line description.
+	Summary string
+}
+
+// Commands are the subcommands of the command line application. The first one
+// is the default.
+var Commands = []Command{
+	{"check", "Probe the protocols and targets, printing each request"},
+	{"monitor", "Probe them, printing only the changes between up and down"},
+	{"serve", "Probe them, serving the results as Prometheus metrics"},
+	{"servers", "List the public servers used by default"},
+	{"history", "Query the reports stored, printing uptime and outages"},
+}
+
+// ParseCommand returns the subcommand and its arguments. The default one if
+// the first argument is a flag or there are none.
+func ParseCommand(args []string) (string, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return Commands[0].Name, args, nil
+	}
+	for _, c := range Commands {
+		if c.Name == args[0] {
+			return c.Name, args[1:], nil
+		}
+	}
+	return "", nil, fmt.Errorf("unknown command: %s", args[0])
+}
+
+// PrintCommands writes the subcommands available.
+func PrintCommands(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [command] [flags]\n", appName)
+	printCommandList(w)
+}
+
+// Writes the list of subcommands.
+func printCommandList(w io.Writer) {
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range Commands {
+		fmt.Fprintf(w, "  %-10s%s\n", c.Name, c.Summary)
+	}
+	fmt.Fprintf(
+		w, "Run '%s <command> -h' for its flags. Default: %s.\n",
+		appName, Commands[0].Name,
+	)
+}
+
+// Descriptions of the commands, for their usage.
+const (
+	descProbe = `
+Troubleshoot problems with your Internet connection based on different
+protocols and public servers.`
+	descOutput = `
+OUTPUT
+Details about each request:
+{Protocol used} {Response time} {Remote server} {Extra info}
+Statistics for each protocol and server once finished (or interrupted):
+sent, received, loss and response times (min/avg/max/mdev/p50/p90/p99).`
+	descExit = `
+EXIT STATUS
+This utility exits with one of the following values:
+0 At least one response was heard.
+2 The transmission was successful but no responses were received.
+1 Any other error occurred.
+The requirements can be stricter: a response from every protocol and
+server (-all) and/or a minimum ratio of successful requests (-ratio).`
+	descMonitor = `
+MONITOR
+Only the changes of each protocol and server between up and down are
+printed, once a number of consecutive requests fail (-down) or succeed
+(-up). Recoveries include the duration of the outage:
+{Time} {Up or down} {Protocol used} {Remote server} {Outage or error}`
+	descNotify = `
+NOTIFICATIONS
+The changes between up and down can also be sent to a webhook (-wh), in
+JSON or using a Slack or Teams payload (-wt), and/or a command can run for
+each one (-exec). The command gets the change in JSON through its standard
+input and in UP_EVENT_* environment variables (ie: UP_EVENT_STATE).
+Failures are retried and the notifications limited per minute (-rl).`
+	descRecord = `
+HISTORY
+With -rec, the reports are also appended to a local file (-hist), rotated
+when it grows. See 'up history -h'.`
+	descServe = `
+METRICS
+The Prometheus metrics are served on the address (-m), in the '/metrics'
+path, while the probes run until they are interrupted (-c 0).`
+	descServers = `
+List the public servers used by default, by kind (-k): captive portals
+(http), DNS resolvers (dns, dns-ipv6), also the targets of tcp, icmp and
+trace, DNS-over-HTTPS (doh), DNS-over-TLS (dot), HTTPS servers (tls), STUN
+servers (stun), the targets of udp, NTP servers (ntp) and HTTP/3 servers
+(http3).`
+	descHistory = `
+Query the reports stored with -rec, by protocol, target and time range,
+printing the uptime percentage, the outages and the response times over
+periods of time (-step).`
+)
+
+// Returns the description of a command.
+func commandDesc(command string) string {
+	switch command {
+	case "check":
+		return descProbe + "\n" + descOutput + "\n" + descExit + "\n" +
+			descNotify + "\n" + descRecord
+	case "monitor":
+		return descProbe + "\n" + descMonitor + "\n" + descNotify + "\n" +
+			descRecord
+	case "serve":
+		return descProbe + "\n" + descServe + "\n" + descNotify + "\n" +
+			descRecord
+	case "servers":
+		return descServers
+	case "history":
+		return descHistory
+	default:
+		return ""
+	}
+}
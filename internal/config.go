@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/jesusprubio/up/probe"
+)
+
+// Config describes the checks to run, loaded from a JSON file.
+//
+// Example:
+//
+//	{
+//	  "checks": [
+//	    {
+//	      "name": "portal",
+//	      "protocol": "http",
+//	      "targets": ["http://example.com"],
+//	      "count": 3,
+//	      "interval": "1s",
+//	      "timeout": "2s",
+//	      "expected_status": 200
+//	    }
+//	  ]
+//	}
+type Config struct {
+	Checks []*Check `json:"checks"`
+}
+
+// Check is a named probe with its own settings.
+//
+// The zero values are replaced by the defaults of the command line options.
+type Check struct {
+	// Used to label the reports.
+	Name string `json:"name"`
+	// Protocol to use. Example: 'http'.
+	Protocol string `json:"protocol"`
+	// Where to point the probe. A random public server if empty.
+	Targets []string `json:"targets"`
+	// Number of iterations. Zero means infinite.
+	Count uint `json:"count"`
+	// Delay between requests.
+	Interval Duration `json:"interval"`
+	// Time to wait for a response.
+	Timeout Duration `json:"timeout"`
+	// IP address family: '4', '6' or 'both' (to compare them).
+	Family string `json:"family"`
+	// Custom DNS resolver (DNS). Example: 'tls://1.1.1.1'.
+	Resolver string `json:"resolver"`
+	// HTTP method for DNS-over-HTTPS resolvers (DNS), 'GET' or 'POST'.
+	DoHMethod string `json:"doh_method"`
+	// Compare the answers of all the public resolvers (DNS), or the requests
+	// through the proxy and direct ones (HTTP).
+	Compare bool `json:"compare"`
+	// URL of the proxy to connect through (HTTP). The one of the environment
+	// by default. Example: 'socks5://127.0.0.1:1080'.
+	Proxy string `json:"proxy"`
+	// Ignore the proxy of the environment (HTTP).
+	Direct bool `json:"direct"`
+	// Packets to trace the route (trace): 'udp', 'tcp' or 'icmp'.
+	TraceMethod string `json:"trace_method"`
+	// Payload to send (UDP): 'dns', 'ntp', 'stun' or a custom text.
+	Payload string `json:"payload"`
+	// Offset of the local clock flagged as a warning (NTP). Example: '500ms'.
+	MaxOffset Duration `json:"max_offset"`
+	// Record type to query (DNS). Example: 'MX'.
+	RecordType string `json:"record_type"`
+	// Expected response status code (HTTP).
+	ExpectedStatus int `json:"expected_status"`
+	// Text the response body must contain (HTTP).
+	ExpectedBody string `json:"expected_body"`
+	// Regular expression the response body must match (HTTP).
+	ExpectedBodyRegexp string `json:"expected_body_regexp"`
+	// Headers the response must include (HTTP). An empty value only checks
+	// they are present.
+	ExpectedHeaders map[string]string `json:"expected_headers"`
+}
+
+// Duration is a time.Duration encoded as a string in JSON. Example: "1.5s".
+type Duration time.Duration
+
+// UnmarshalJSON parses the duration from a JSON string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadConfig reads the checks from a JSON file.
+//
+// Returns an error if the file can not be read or the checks are invalid.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var config Config
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+	err = config.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &config, nil
+}
+
+// Ensures the checks are correct.
+func (c *Config) validate() error {
+	if len(c.Checks) == 0 {
+		return errors.New("no checks")
+	}
+	names := map[string]bool{}
+	for i, check := range c.Checks {
+		if check.Name == "" {
+			return fmt.Errorf("check %d: name is required", i)
+		}
+		if names[check.Name] {
+			return fmt.Errorf("check %s: duplicated name", check.Name)
+		}
+		names[check.Name] = true
+		settings, err := check.settings(0, probe.Bind{})
+		if err != nil {
+			return fmt.Errorf("check %s: %w", check.Name, err)
+		}
+		_, err = probe.NewProtocol(check.Protocol, settings)
+		if err != nil {
+			return fmt.Errorf("check %s: %w", check.Name, err)
+		}
+		if check.Proxy != "" {
+			_, err = probe.ParseProxy(check.Proxy)
+			if err != nil {
+				return fmt.Errorf("check %s: %w", check.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the expected HTTP response.
+func (c *Check) expectation() (probe.Expectation, error) {
+	expect := probe.Expectation{
+		Status:  c.ExpectedStatus,
+		Body:    c.ExpectedBody,
+		Headers: c.ExpectedHeaders,
+	}
+	if c.ExpectedBodyRegexp != "" {
+		re, err := regexp.Compile(c.ExpectedBodyRegexp)
+		if err != nil {
+			return expect, fmt.Errorf("parsing body regular expression: %w", err)
+		}
+		expect.BodyRegexp = re
+	}
+	return expect, nil
+}
+
+// Returns the settings of the protocol, with the default timeout and the local
+// end of the connections.
+func (c *Check) settings(
+	timeout time.Duration, bind probe.Bind,
+) (probe.Settings, error) {
+	expect, err := c.expectation()
+	if err != nil {
+		return probe.Settings{}, err
+	}
+	settings := probe.Settings{
+		Timeout:      timeout,
+		Family:       probe.Family(c.Family),
+		DNSResolver:  c.Resolver,
+		DNSType:      c.RecordType,
+		DoHMethod:    c.DoHMethod,
+		DNSCompare:   c.Compare,
+		TraceMethod:  c.TraceMethod,
+		Expect:       expect,
+		Proxy:        c.Proxy,
+		Direct:       c.Direct,
+		ProxyCompare: c.Compare,
+		Bind:         bind,
+		UDPPayload:   c.Payload,
+		NTPMaxOffset: time.Duration(c.MaxOffset),
+	}
+	if c.Timeout != 0 {
+		settings.Timeout = time.Duration(c.Timeout)
+	}
+	return settings, nil
+}
+
+// Probes returns the probes of the check, one for each target, with the local
+// end of the connections.
+//
+// The defaults are used for the unset properties.
+func (c *Check) Probes(
+	defaults probe.Probe, timeout time.Duration, bind probe.Bind,
+) ([]*probe.Probe, error) {
+	settings, err := c.settings(timeout, bind)
+	if err != nil {
+		return nil, err
+	}
+	targets := c.Targets
+	if len(targets) == 0 {
+		targets = []string{""}
+	}
+	var probes []*probe.Probe
+	for _, target := range targets {
+		proto, err := probe.NewProtocol(c.Protocol, settings)
+		if err != nil {
+			return nil, err
+		}
+		p := defaults
+		p.Name = c.Name
+		p.Proto = proto
+		p.Target = target
+		if c.Count != 0 {
+			p.Count = c.Count
+		}
+		if c.Interval != 0 {
+			p.Delay = time.Duration(c.Interval)
+		}
+		probes = append(probes, &p)
+	}
+	return probes, nil
+}
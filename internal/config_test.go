@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jesusprubio/up/probe"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("returns the checks of the file", func(t *testing.T) {
+		config, err := LoadConfig("../testdata/checks.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(config.Checks) != 3 {
+			t.Fatalf("got %d checks, want %d", len(config.Checks), 3)
+		}
+		check := config.Checks[1]
+		if check.Name != "portal" {
+			t.Fatalf("got %q, want %q", check.Name, "portal")
+		}
+		if check.Timeout != Duration(3*time.Second) {
+			t.Fatalf("got %s, want %s", time.Duration(check.Timeout), 3*time.Second)
+		}
+		if check.ExpectedStatus != 204 {
+			t.Fatalf("got %d, want %d", check.ExpectedStatus, 204)
+		}
+	})
+	for _, tt := range []struct{ name, content, want string }{
+		{"it is not JSON", `checks:`, "parsing config file: "},
+		{"a duration is invalid", `{"checks":[{"interval":"1"}]}`, "parsing config file: "},
+		{"there are no checks", `{"checks":[]}`, "invalid config: no checks"},
+		{
+			"a name is missing",
+			`{"checks":[{"protocol":"tcp"}]}`,
+			"invalid config: check 0: name is required",
+		},
+		{
+			"a name is duplicated",
+			`{"checks":[{"name":"a","protocol":"tcp"},{"name":"a","protocol":"dns"}]}`,
+			"invalid config: check a: duplicated name",
+		},
+		{
+			"a regular expression is invalid",
+			`{"checks":[{"name":"a","protocol":"http","expected_body_regexp":"("}]}`,
+			"invalid config: check a: parsing body regular expression: ",
+		},
+		{
+			"a protocol is unknown",
+			`{"checks":[{"name":"a","protocol":"foo"}]}`,
+			"invalid config: check a: unknown protocol: foo",
+		},
+		{
+			"a family is unknown",
+			`{"checks":[{"name":"a","protocol":"tcp","family":"5"}]}`,
+			"invalid config: check a: unsupported address family: 5",
+		},
+		{
+			"a record type is unknown",
+			`{"checks":[{"name":"a","protocol":"dns","record_type":"FOO"}]}`,
+			"invalid config: check a: unsupported record type: FOO",
+		},
+	} {
+		t.Run("returns an error if "+tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "checks.json")
+			err := os.WriteFile(path, []byte(tt.content), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = LoadConfig(path)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Fatalf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+	t.Run("returns an error if the file does not exist", func(t *testing.T) {
+		_, err := LoadConfig("not-found.json")
+		if err == nil {
+			t.Fatal("got nil, want an error")
+		}
+	})
+}
+
+func TestCheckProbes(t *testing.T) {
+	defaults := probe.Probe{Count: 5, Delay: time.Second}
+	t.Run("returns a probe for each target", func(t *testing.T) {
+		check := Check{
+			Name:               "portal",
+			Protocol:           "http",
+			Targets:            []string{"http://a", "http://b"},
+			Count:              2,
+			Interval:           Duration(time.Minute),
+			Timeout:            Duration(time.Hour),
+			ExpectedStatus:     204,
+			ExpectedBody:       "ok",
+			ExpectedBodyRegexp: "^o",
+			ExpectedHeaders:    map[string]string{"Server": "up"},
+		}
+		probes, err := check.Probes(defaults, time.Second, probe.Bind{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(probes) != 2 {
+			t.Fatalf("got %d probes, want %d", len(probes), 2)
+		}
+		for i, p := range probes {
+			if p.Name != "portal" {
+				t.Fatalf("got %q, want %q", p.Name, "portal")
+			}
+			if p.Target != check.Targets[i] {
+				t.Fatalf("got %q, want %q", p.Target, check.Targets[i])
+			}
+			if p.Count != 2 {
+				t.Fatalf("got %d, want %d", p.Count, 2)
+			}
+			if p.Delay != time.Minute {
+				t.Fatalf("got %s, want %s", p.Delay, time.Minute)
+			}
+			proto := p.Proto.(*probe.HTTP)
+			if proto.Timeout != time.Hour {
+				t.Fatalf("got %s, want %s", proto.Timeout, time.Hour)
+			}
+			if proto.Expect.Status != 204 {
+				t.Fatalf("got %d, want %d", proto.Expect.Status, 204)
+			}
+			if proto.Expect.Body != "ok" {
+				t.Fatalf("got %q, want %q", proto.Expect.Body, "ok")
+			}
+			if proto.Expect.BodyRegexp.String() != "^o" {
+				t.Fatalf("got %q, want %q", proto.Expect.BodyRegexp, "^o")
+			}
+			if proto.Expect.Headers["Server"] != "up" {
+				t.Fatalf("got %q, want %q", proto.Expect.Headers["Server"], "up")
+			}
+		}
+	})
+	t.Run("compares the address families", func(t *testing.T) {
+		check := Check{Name: "tcp", Protocol: "tcp", Family: "both"}
+		probes, err := check.Probes(defaults, time.Second, probe.Bind{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, ok := probes[0].Proto.(*probe.DualStack)
+		if !ok {
+			t.Fatalf("got %T, want %T", probes[0].Proto, &probe.DualStack{})
+		}
+	})
+	t.Run("binds the connections", func(t *testing.T) {
+		check := Check{Name: "tcp", Protocol: "tcp"}
+		bind := probe.Bind{Interface: "eth0"}
+		probes, err := check.Probes(defaults, time.Second, bind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proto := probes[0].Proto.(*probe.TCP)
+		if proto.Bind.Interface != "eth0" {
+			t.Fatalf("got %q, want %q", proto.Bind.Interface, "eth0")
+		}
+	})
+	t.Run("uses the defaults for the unset properties", func(t *testing.T) {
+		check := Check{
+			Name: "dns", Protocol: "dns", Resolver: "1.1.1.1", RecordType: "MX",
+		}
+		probes, err := check.Probes(defaults, time.Second, probe.Bind{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(probes) != 1 {
+			t.Fatalf("got %d probes, want %d", len(probes), 1)
+		}
+		p := probes[0]
+		if p.Target != "" {
+			t.Fatalf("got %q, want a random target", p.Target)
+		}
+		if p.Count != 5 {
+			t.Fatalf("got %d, want %d", p.Count, 5)
+		}
+		if p.Delay != time.Second {
+			t.Fatalf("got %s, want %s", p.Delay, time.Second)
+		}
+		proto := p.Proto.(*probe.DNS)
+		if proto.Timeout != time.Second {
+			t.Fatalf("got %s, want %s", proto.Timeout, time.Second)
+		}
+		if proto.Resolver != "1.1.1.1" {
+			t.Fatalf("got %q, want %q", proto.Resolver, "1.1.1.1")
+		}
+		if proto.Type != "MX" {
+			t.Fatalf("got %q, want %q", proto.Type, "MX")
+		}
+	})
+}
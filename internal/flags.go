@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Prefix of the environment variables overriding the flag defaults.
+const envPrefix = "UP_"
+
+// Wraps the standard flag set to support long aliases of the terse names and
+// environment variables.
+type flagSet struct {
+	*flag.FlagSet
+	// Description of the command, for the usage.
+	desc string
+	// Long name of the flags, by short name, in order of definition.
+	shorts []string
+	longs  map[string]string
+}
+
+// Returns an empty flag set for the command.
+func newFlagSet(command, desc string) *flagSet {
+	fs := &flagSet{
+		FlagSet: flag.NewFlagSet(command, flag.ContinueOnError),
+		desc:    desc,
+		longs:   map[string]string{},
+	}
+	// The usage is printed instead, the error is returned.
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() { fs.printUsage(os.Stderr) }
+	return fs
+}
+
+// Sets the long name of flags already defined, as pairs of short and long
+// names. Example: "tg", "target". The flags not defined for the command are
+// skipped.
+func (fs *flagSet) alias(pairs ...string) {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		short, long := pairs[i], pairs[i+1]
+		f := fs.Lookup(short)
+		if f == nil {
+			continue
+		}
+		if long != short {
+			fs.Var(f.Value, long, f.Usage)
+		}
+		fs.shorts = append(fs.shorts, short)
+		fs.longs[short] = long
+	}
+}
+
+// Returns the environment variable of a flag. Example: 'UP_TARGET'.
+func (fs *flagSet) env(short string) string {
+	name := strings.ReplaceAll(fs.longs[short], "-", "_")
+	return envPrefix + strings.ToUpper(name)
+}
+
+// Parses the arguments, after setting the flags present in the environment.
+// The arguments take precedence.
+func (fs *flagSet) parse(args []string) error {
+	for _, short := range fs.shorts {
+		value, ok := os.LookupEnv(fs.env(short))
+		if !ok {
+			continue
+		}
+		err := fs.Set(short, value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", fs.env(short), value, err)
+		}
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+// Writes the description of the command and its flags, with their aliases and
+// environment variables.
+func (fs *flagSet) printUsage(w io.Writer) {
+	if fs.Name() == Commands[0].Name {
+		fmt.Fprintf(w, "Usage: %s [%s] [flags]\n", appName, fs.Name())
+	} else {
+		fmt.Fprintf(w, "Usage: %s %s [flags]\n", appName, fs.Name())
+	}
+	if fs.desc != "" {
+		fmt.Fprintf(w, "%s\n", fs.desc)
+	}
+	if fs.Name() == Commands[0].Name {
+		printCommandList(w)
+	}
+	fmt.Fprintln(w, "\nFlags:")
+	for _, short := range fs.shorts {
+		f := fs.Lookup(short)
+		kind, usage := flag.UnquoteUsage(f)
+		names := "-" + short
+		if long := fs.longs[short]; long != short {
+			names = fmt.Sprintf("%s, -%s", names, long)
+		}
+		if kind != "" {
+			names = fmt.Sprintf("%s %s", names, kind)
+		}
+		fmt.Fprintf(w, "  %s\n    \t%s", names, usage)
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" &&
+			f.DefValue != "0s" && f.DefValue != "[]" {
+			fmt.Fprintf(w, " (default %q)", f.DefValue)
+		}
+		fmt.Fprintf(w, " [$%s]\n", fs.env(short))
+	}
+}
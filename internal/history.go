@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jesusprubio/up/probe"
+)
+
+// HistoryOptions are the flags supported by the history subcommand.
+type HistoryOptions struct {
+	// Path of the history file.
+	Path string
+	// Only the reports of this protocol.
+	Protocol string
+	// Only the reports of this target.
+	Target string
+	// Only the reports of the last period, if the start time is not set.
+	Since time.Duration
+	// Time range of the reports.
+	From time.Time
+	To   time.Time
+	// Period to aggregate the response times.
+	Step time.Duration
+	// Output in JSON format.
+	JSONOutput bool
+	// Output in grepable format.
+	GrepOutput bool
+	// Disable color output.
+	NoColor bool
+}
+
+// DefaultHistoryPath returns the file used to store the reports if none is
+// set, in the cache directory of the user.
+func DefaultHistoryPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "up", "history.jsonl")
+}
+
+// Parse fulfills the flags of the subcommand provided by the user.
+//
+// Returns flag.ErrHelp if the usage is requested.
+func (opts *HistoryOptions) Parse(args []string) error {
+	fs := newFlagSet("history", commandDesc("history"))
+	fs.StringVar(
+		&opts.Path, "hist", DefaultHistoryPath(), "File the reports are stored in",
+	)
+	fs.StringVar(&opts.Protocol, "p", "", "Only the reports of this protocol")
+	fs.StringVar(&opts.Target, "tg", "", "Only the reports of this target")
+	fs.DurationVar(
+		&opts.Since, "since", 24*time.Hour,
+		"Only the reports of the last period, if -from is not set",
+	)
+	fs.Func(
+		"from", "Only the reports since this time (RFC 3339)",
+		func(s string) (err error) {
+			opts.From, err = time.Parse(time.RFC3339, s)
+			return err
+		},
+	)
+	fs.Func(
+		"to", "Only the reports before this time (RFC 3339)",
+		func(s string) (err error) {
+			opts.To, err = time.Parse(time.RFC3339, s)
+			return err
+		},
+	)
+	fs.DurationVar(
+		&opts.Step, "step", time.Hour, "Period to aggregate the response times",
+	)
+	fs.BoolVar(&opts.JSONOutput, "j", false, "Output in JSON format")
+	fs.BoolVar(&opts.GrepOutput, "g", false, "Output in grepable format")
+	fs.BoolVar(&opts.NoColor, "nc", false, "Disable color output")
+	fs.alias(
+		"hist", "history-file", "p", "protocol", "tg", "target",
+		"since", "since", "from", "from", "to", "to", "step", "step",
+		"j", "json", "g", "grep", "nc", "no-color",
+	)
+	err := fs.parse(args)
+	if err != nil {
+		return err
+	}
+	if opts.Step <= 0 {
+		return errors.New("step must be positive")
+	}
+	return nil
+}
+
+// Query returns the selection of the reports.
+func (opts *HistoryOptions) Query(now time.Time) probe.HistoryQuery {
+	q := probe.HistoryQuery{
+		ProtocolID: opts.Protocol,
+		Target:     opts.Target,
+		Since:      opts.From,
+		Until:      opts.To,
+	}
+	if q.Since.IsZero() && opts.Since > 0 {
+		q.Since = now.Add(-opts.Since)
+	}
+	return q
+}
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		command string
+		rest    int
+	}{
+		{"no arguments", nil, "check", 0},
+		{"only flags", []string{"-p", "tcp"}, "check", 2},
+		{"a command", []string{"monitor", "-p", "tcp"}, "monitor", 2},
+	} {
+		t.Run("returns the command if there are "+tt.name, func(t *testing.T) {
+			command, rest, err := ParseCommand(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if command != tt.command || len(rest) != tt.rest {
+				t.Fatalf(
+					"got %q %v, want %q with %d arguments",
+					command, rest, tt.command, tt.rest,
+				)
+			}
+		})
+	}
+	t.Run("returns an error if the command is unknown", func(t *testing.T) {
+		_, _, err := ParseCommand([]string{"foo"})
+		want := "unknown command: foo"
+		if err == nil || err.Error() != want {
+			t.Fatalf("got %v, want %q", err, want)
+		}
+	})
+}
+
+func TestOptionsParse(t *testing.T) {
+	t.Run("supports the short and long names", func(t *testing.T) {
+		var opts Options
+		err := opts.Parse("check", []string{"-p", "tcp", "-target", "1.1.1.1:53"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts.Protocol != "tcp" || opts.Target != "1.1.1.1:53" {
+			t.Fatalf(
+				"got %q %q, want the protocol and target",
+				opts.Protocol, opts.Target,
+			)
+		}
+	})
+	t.Run("supports the environment variables", func(t *testing.T) {
+		t.Setenv("UP_TIMEOUT", "10s")
+		t.Setenv("UP_PROTOCOL", "dns")
+		var opts Options
+		err := opts.Parse("check", []string{"-p", "tcp"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts.Timeout != 10*time.Second {
+			t.Fatalf("got %s, want %s", opts.Timeout, 10*time.Second)
+		}
+		// The arguments take precedence.
+		if opts.Protocol != "tcp" {
+			t.Fatalf("got %q, want %q", opts.Protocol, "tcp")
+		}
+	})
+	t.Run("uses the defaults of the command", func(t *testing.T) {
+		var monitor, serve Options
+		err := monitor.Parse("monitor", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = serve.Parse("serve", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !monitor.Monitor || serve.MetricsAddr != ":9090" {
+			t.Fatalf(
+				"got %v %q, want the monitor and metrics",
+				monitor.Monitor, serve.MetricsAddr,
+			)
+		}
+	})
+	t.Run("rejects the flags which do nothing in the command", func(t *testing.T) {
+		for command, args := range map[string][]string{
+			"monitor": {"-mon"},
+			"serve":   {"-stop"},
+		} {
+			var opts Options
+			err := opts.Parse(command, args)
+			want := "flag provided but not defined: " + args[0]
+			if err == nil || err.Error() != want {
+				t.Fatalf("%s: got %v, want %q", command, err, want)
+			}
+		}
+	})
+	t.Run("returns flag.ErrHelp if the usage is requested", func(t *testing.T) {
+		var opts Options
+		err := opts.Parse("check", []string{"-h"})
+		if !errors.Is(err, flag.ErrHelp) {
+			t.Fatalf("got %v, want %v", err, flag.ErrHelp)
+		}
+	})
+	for _, tt := range []struct {
+		name string
+		args []string
+		env  string
+		want string
+	}{
+		{
+			"a flag is unknown", []string{"-foo"}, "",
+			"flag provided but not defined: -foo",
+		},
+		{"there are arguments", []string{"foo"}, "", "unexpected arguments: foo"},
+		{
+			"the target lacks the protocol", []string{"-tg", "example.com"}, "",
+			"protocol is required if target is set",
+		},
+		{
+			"the family is unknown", []string{"-ip", "5"}, "",
+			"unsupported address family: 5",
+		},
+		{
+			"the source is not an IP", []string{"-source", "eth0"}, "",
+			"invalid source address: eth0",
+		},
+		{
+			"all the interfaces and one are set",
+			[]string{"-ifs", "-if", "eth0"}, "",
+			"interface and source are not compatible with all-interfaces",
+		},
+		{
+			"an environment variable is invalid", nil, "1",
+			`invalid UP_TIMEOUT "1": `,
+		},
+	} {
+		t.Run("returns an error if "+tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("UP_TIMEOUT", tt.env)
+			}
+			var opts Options
+			err := opts.Parse("check", tt.args)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Fatalf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -1,148 +1,113 @@
 package internal
 
 import (
-	"crypto/rand"
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"math/big"
-	"net"
-	"net/url"
-)
-
-const tmplRandom = "creating random number: %w"
+	"strings"
+	"text/tabwriter"
 
-// RandomCaptivePortal returns a captive portal URL selected randomly from the
-// list of well-known companies.
-//
-// Returns an error if the random number generator fails.
-func RandomCaptivePortal() (string, error) {
-	count := big.NewInt(int64(len(CaptivePortals)))
-	index, err := rand.Int(rand.Reader, count)
-	if err != nil {
-		return "", fmt.Errorf(tmplRandom, err)
-	}
-	return CaptivePortals[index.Int64()].String(), nil
-}
+	"github.com/jesusprubio/up/probe"
+)
 
-// CaptivePortals are URLs that well-known companies use inspect the network
-// connections of their users.
-var CaptivePortals []*url.URL = []*url.URL{
-	// Google Chrome.
-	{
-		Scheme: "http",
-		Host:   "clients3.google.com:80",
-		Path:   "/generate_204",
-	},
-	// Mozilla Firefox.
-	{
-		Scheme: "http",
-		Host:   "detectportal.firefox.com:80",
-		Path:   "/success.txt",
-	},
-	// Apple.
-	{
-		Scheme: "http",
-		Host:   "www.apple.com:80",
-		Path:   "/library/test/success.html",
-	},
-	// Microsoft.
-	{
-		Scheme: "http",
-		Host:   "www.msftconnecttest.com:80",
-		Path:   "/redirect",
-	},
-	// Android.
-	{
-		Scheme: "http",
-		Host:   "connectivitycheck.android.com:80",
-		Path:   "/generate_204",
-	},
-	// Ubuntu.
-	{
-		Scheme: "http",
-		Host:   "connectivity-check.ubuntu.com:80",
-	},
-	// Debian.
-	{
-		Scheme: "http",
-		Host:   "network-test.debian.org:80",
-	},
+// ServersOptions are the flags supported by the servers subcommand.
+type ServersOptions struct {
+	// Only the servers of this kind.
+	Kind string
+	// Output in JSON format.
+	JSONOutput bool
+	// Output in grepable format.
+	GrepOutput bool
 }
 
-// RandomDNSServer returns a randomly selected public DNS server address.
+// Parse fulfills the flags of the subcommand provided by the user.
 //
-// Returns an error if the random number generator fails.
-func RandomDNSServer() (string, error) {
-	count := big.NewInt(int64(len(Resolvers)))
-	index, err := rand.Int(rand.Reader, count)
-	if err != nil {
-		return "", fmt.Errorf(tmplRandom, err)
-	}
-	return Resolvers[index.Int64()].String(), nil
+// Returns flag.ErrHelp if the usage is requested.
+func (opts *ServersOptions) Parse(args []string) error {
+	fs := newFlagSet("servers", commandDesc("servers"))
+	fs.StringVar(
+		&opts.Kind, "k", "",
+		"Only the servers of this kind (ie: 'dns', 'doh')",
+	)
+	fs.BoolVar(&opts.JSONOutput, "j", false, "Output in JSON format")
+	fs.BoolVar(&opts.GrepOutput, "g", false, "Output in grepable format")
+	fs.alias("k", "kind", "j", "json", "g", "grep")
+	return fs.parse(args)
 }
 
-// Resolvers is a list of public DNS server IP addresses.
-var Resolvers = []*net.IP{
-	// Cloudflare
-	{1, 1, 1, 1},
-	{1, 0, 0, 1},
-	// Google
-	{8, 8, 8, 8},
-	{8, 8, 4, 4},
-	// OpenDNS
-	{208, 67, 222, 222},
-	{208, 67, 222, 220},
-	// Control D
-	{76, 76, 2, 0},
-	{76, 76, 10, 0},
-	// AdGuard
-	{94, 140, 14, 14},
-	{94, 140, 15, 15},
-	// CleanBrowsing
-	{185, 228, 168, 9},
-	{185, 228, 169, 9},
-	// Verisign
-	{64, 6, 64, 6},
-	{64, 6, 65, 6},
-	// Quad9
-	{9, 9, 9, 9},
-	{149, 112, 112, 112},
-	// Neustar
-	{156, 154, 70, 1},
-	{156, 154, 71, 1},
-	// Yandex
-	{77, 88, 8, 8},
-	{77, 88, 8, 1},
-	// SafeDNS
-	{195, 46, 39, 39},
-	{195, 46, 39, 40},
-	// Norton ConnectSafe
-	{199, 85, 126, 10},
-	{199, 85, 127, 10},
+// Server is one of the public servers used by default.
+type Server struct {
+	// Example: 'dns'.
+	Kind string `json:"kind"`
+	// Depends on the kind: URL, IP address or host:port.
+	Address string `json:"address"`
 }
 
-// RandomTCPServer returns a TCP host:port selected randomly from the public DNS
-// servers.
-//
-// Returns an error if the random number generator fails.
-func RandomTCPServer() (string, error) {
-	serverAddr, err := RandomDNSServer()
-	if err != nil {
-		return "", fmt.Errorf(tmplRandom, err)
+// Servers returns the public servers used by default, of a kind if set.
+func Servers(kind string) []Server {
+	var servers []Server
+	add := func(k, addr string) {
+		if kind == "" || kind == k {
+			servers = append(servers, Server{k, addr})
+		}
+	}
+	for _, p := range probe.CaptivePortals {
+		add("http", p.URL.String())
+	}
+	for _, ip := range probe.Resolvers {
+		add("dns", ip.String())
 	}
-	return net.JoinHostPort(serverAddr, "53"), nil
+	for _, ip := range probe.ResolversIPv6 {
+		add("dns-ipv6", ip.String())
+	}
+	for _, addr := range probe.DoHServers {
+		add("doh", addr)
+	}
+	for _, addr := range probe.DoTServers {
+		add("dot", addr)
+	}
+	for _, addr := range probe.TLSServers {
+		add("tls", addr)
+	}
+	for _, addr := range probe.STUNServers {
+		add("stun", addr)
+	}
+	for _, addr := range probe.NTPServers {
+		add("ntp", addr)
+	}
+	for _, addr := range probe.HTTP3Servers {
+		add("http3", addr)
+	}
+	return servers
 }
 
-// RandomDomain returns a domain selected randomly from the captive portals.
-//
-// Returns an error if the random number generator fails.
-func RandomDomain() (string, error) {
-	portalURL, err := RandomCaptivePortal()
-	if err != nil {
-		return "", fmt.Errorf(tmplRandom, err)
-	}
-	u, err := url.Parse(portalURL)
-	if err != nil {
-		return "", fmt.Errorf("parsing URL %s: %w", portalURL, err)
+// ServersString returns the servers ready to be printed.
+func ServersString(servers []Server, format probe.Format) (string, error) {
+	switch format {
+	case probe.HumanFormat:
+		var buf bytes.Buffer
+		w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tADDRESS")
+		for _, s := range servers {
+			fmt.Fprintf(w, "%s\t%s\n", s.Kind, s.Address)
+		}
+		w.Flush()
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	case probe.JSONFormat:
+		out, err := json.Marshal(struct {
+			Servers []Server `json:"servers"`
+		}{servers})
+		if err != nil {
+			return "", fmt.Errorf("marshaling servers: %w", err)
+		}
+		return string(out), nil
+	case probe.GrepFormat:
+		lines := make([]string, 0, len(servers))
+		for _, s := range servers {
+			lines = append(lines, fmt.Sprintf("server\t%s\t%s", s.Kind, s.Address))
+		}
+		return strings.Join(lines, "\n"), nil
+	default:
+		return "", fmt.Errorf("unsupported format: %v", format)
 	}
-	return u.Hostname(), nil
 }
@@ -1,4 +1,4 @@
-// Package main implements a simple CLI to use the library.
+// Package main implements a simple CLI to use the library (see "probe").
 package main
 
 import (
@@ -7,36 +7,47 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
-	"sync"
 	"syscall"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/jesusprubio/up/internal"
+	"github.com/jesusprubio/up/probe"
 )
 
 const (
-	appName = "up"
-	appDesc = `
-	Troubleshoot problems with your Internet connection based on different
-	protocols and public servers.
-
-	OUTPUT
-	Details about each request:
-	{Protocol used} {Response time} {Remote server} {Extra info}
-
-	EXIT STATUS
-	This utility exits with one of the following values:
-	0 At least one response was heard.
-	2 The transmission was successful but no responses were received.
-	1 Any other error occurred.
-	`
+	appName           = "up"
 	targetConcurrency = 5 // stdin inputs
+	// Retries of the failed notifications, and the delay before the first.
+	notifyRetries    = 3
+	notifyRetryDelay = time.Second
+	// Exit status when the requirements are not met.
+	exitNoResponse = 2
 )
 
 func main() {
+	command, args, err := internal.ParseCommand(os.Args[1:])
+	if err != nil {
+		internal.PrintCommands(os.Stderr)
+		fatal(err)
+	}
+	switch command {
+	case "servers":
+		runServers(args)
+	case "history":
+		runHistory(args)
+	default:
+		runProbes(command, args)
+	}
+}
+
+// Probes the protocols and targets: "check", "monitor" or "serve" commands.
+func runProbes(command string, args []string) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	// Only used for debugging.
@@ -50,45 +61,131 @@ func main() {
 		fatal(fmt.Errorf("reading stdin: %w", err))
 	}
 	var opts internal.Options
-	err = opts.Parse()
-	if err != nil {
-		fatal(fmt.Errorf("parsing options: %w", err))
-	}
+	checkOptions(opts.Parse(command, args))
 	if opts.Debug {
 		lvl.Set(slog.LevelDebug)
 	}
 	logger.Debug("Starting ...", "options", opts, "stdin", stdin)
-	dnsProtocol := &internal.DNS{Timeout: opts.Timeout}
-	if opts.DNSResolver != "" {
-		dnsProtocol.Resolver = opts.DNSResolver
+	protocolIDs := probe.DefaultProtocolIDs()
+	if opts.Protocol != "" {
+		protocolIDs = []string{opts.Protocol}
 	}
-	protocols := []internal.Protocol{
-		&internal.HTTP{Timeout: opts.Timeout},
-		&internal.TCP{Timeout: opts.Timeout},
-		dnsProtocol,
+	expect, err := opts.Expectation()
+	if err != nil {
+		fatal(err)
 	}
-	if opts.Protocol != "" {
-		var protocol internal.Protocol
-		for _, p := range protocols {
-			if p.String() == opts.Protocol {
-				protocol = p
-				break
-			}
+	settings := probe.Settings{
+		Timeout:      opts.Timeout,
+		Family:       probe.Family(opts.Family),
+		DNSResolver:  opts.DNSResolver,
+		DNSType:      opts.DNSType,
+		DoHMethod:    opts.DoHMethod,
+		DNSCompare:   opts.DNSCompare,
+		TraceMethod:  opts.TraceMethod,
+		UDPPayload:   opts.UDPPayload,
+		NTPMaxOffset: opts.MaxOffset,
+		Expect:       expect,
+		Proxy:        opts.Proxy,
+		Direct:       opts.Direct,
+		ProxyCompare: opts.ProxyCompare,
+		Bind:         opts.Bind(),
+	}
+	var protocols []probe.Protocol
+	for _, id := range protocolIDs {
+		protocol, err := probe.NewProtocol(id, settings)
+		if err != nil {
+			fatal(err)
 		}
-		if protocol == nil {
-			fatal(fmt.Errorf("unknown protocol: %s", opts.Protocol))
+		protocols = append(protocols, protocol)
+	}
+	// Reports are only labelled with the interface if all of them are used.
+	ifaces := []string{""}
+	if opts.AllInterfaces {
+		ifaces, err = probe.Interfaces()
+		if err != nil {
+			fatal(err)
+		}
+		if len(ifaces) == 0 {
+			fatal(errors.New("no network interfaces up"))
 		}
-		protocols = []internal.Protocol{protocol}
+		logger.Debug("Probing through each interface", "interfaces", ifaces)
 	}
 	logger.Info("Starting ...", "protocols", protocols, "count", opts.Count)
-	if opts.Help {
-		fmt.Fprintf(os.Stderr, "%s\n", appDesc)
-		flag.Usage()
-		os.Exit(1)
-	}
 	if opts.NoColor {
 		color.NoColor = true
 	}
+	runner := probe.Runner{
+		Protocols: protocols,
+		Count:     opts.Count,
+		Delay:     opts.Delay,
+		Logger:    logger,
+	}
+	if opts.Target != "" {
+		runner.Targets = []string{opts.Target}
+	}
+	switch {
+	case opts.ConfigFile != "":
+		config, err := internal.LoadConfig(opts.ConfigFile)
+		if err != nil {
+			fatal(err)
+		}
+		logger.Debug("Running the checks of the config file")
+		runner.Protocols = nil
+		for _, iface := range ifaces {
+			defaults := probe.Probe{
+				Count: opts.Count, Delay: opts.Delay, Interface: iface,
+			}
+			bind := settings.Bind
+			if iface != "" {
+				bind.Interface = iface
+			}
+			for _, check := range config.Checks {
+				probes, err := check.Probes(defaults, opts.Timeout, bind)
+				if err != nil {
+					fatal(
+						fmt.Errorf("creating probes for check %s: %w", check.Name, err),
+					)
+				}
+				runner.Probes = append(runner.Probes, probes...)
+			}
+		}
+	case stdin != "" && !opts.NoStdin:
+		logger.Debug("Reading from standard input")
+		if opts.Protocol == "" {
+			fatal(
+				errors.New(
+					"protocol is required for standard input target reading",
+				),
+			)
+		}
+		if opts.Target != "" {
+			logger.Debug(
+				"Ignoring target from command line",
+				"target",
+				opts.Target,
+			)
+		}
+		runner.Targets = nil
+		for _, part := range strings.Split(stdin, "\n") {
+			target := strings.TrimSpace(part)
+			if target == "" {
+				logger.Debug("Empty part, skipping")
+				continue
+			}
+			runner.Targets = append(runner.Targets, target)
+		}
+		runner.Concurrency = targetConcurrency
+	}
+	if opts.AllInterfaces && opts.ConfigFile == "" {
+		defaults := probe.Probe{Count: opts.Count, Delay: opts.Delay}
+		runner.Probes, err = interfaceProbes(
+			defaults, protocolIDs, runner.Targets, settings, ifaces,
+		)
+		if err != nil {
+			fatal(err)
+		}
+		runner.Protocols = nil
+	}
 	// To wait for termination signals.
 	// - 'Interrupt': Ctrl+C from terminal.
 	// - 'SIGTERM': Sent from Kubernetes.
@@ -101,119 +198,213 @@ func main() {
 		logger.Debug("Termination signal received")
 		cancel()
 	}()
-	reportCh := make(chan *internal.Report)
-	defer close(reportCh)
-	var format internal.Format
+	var format probe.Format
 	switch {
 	case opts.JSONOutput:
-		format = internal.JSONFormat
+		format = probe.JSONFormat
 	case opts.GrepOutput:
-		format = internal.GrepFormat
+		format = probe.GrepFormat
 	default:
-		format = internal.HumanFormat
+		format = probe.HumanFormat
+	}
+	var stats probe.Stats
+	history := probe.History{Path: opts.HistoryPath}
+	defer history.Close()
+	var metrics probe.Metrics
+	monitor := probe.Monitor{DownAfter: opts.DownAfter, UpAfter: opts.UpAfter}
+	if opts.MetricsAddr != "" {
+		listener, err := net.Listen("tcp", opts.MetricsAddr)
+		if err != nil {
+			fatal(fmt.Errorf("listening for metrics requests: %w", err))
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", &metrics)
+		server := &http.Server{Handler: mux}
+		go func() {
+			logger.Debug("Serving metrics", "address", listener.Addr())
+			err := server.Serve(listener)
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal(fmt.Errorf("serving metrics: %w", err))
+			}
+		}()
+		defer server.Close()
 	}
+	hooks := probe.Hooks{
+		Notifiers:  opts.Notifiers(),
+		Retries:    notifyRetries,
+		RetryDelay: notifyRetryDelay,
+		RateLimit:  opts.RateLimit,
+		Logger:     logger,
+	}
+	// Sent in order, without blocking the requests. Dropped if too many are
+	// pending, as the notifiers are too slow.
+	transitionCh := make(chan *probe.Transition, 100)
+	notifyDone := make(chan struct{})
 	go func() {
-		logger.Debug("Listening for reports ...")
-		for report := range reportCh {
-			logger.Debug("New report", "report", *report)
-			repLine, err := report.String(format)
+		defer close(notifyDone)
+		for t := range transitionCh {
+			err := hooks.Notify(context.Background(), t)
 			if err != nil {
-				fatal(err)
-			}
-			fmt.Println(repLine)
-			if report.Error == "" {
-				if opts.Stop {
-					logger.Debug("Stopping after first successful request")
-					cancel()
-				}
+				logger.Error("Notifying change", "error", err)
 			}
 		}
 	}()
-	var wg sync.WaitGroup
-	if stdin != "" && !opts.NoStdin {
-		logger.Debug("Reading from standard input")
-		parts := strings.Split(stdin, "\n")
-		logger.Debug("Parts", "parts", parts)
-		if opts.Protocol == "" {
-			fatal(
-				errors.New(
-					"protocol is required for standard input target reading",
-				),
-			)
+	logger.Debug("Listening for reports ...")
+	err = runner.Run(ctx, func(report *probe.Report) {
+		logger.Debug("New report", "report", *report)
+		stats.Add(report)
+		if opts.Record {
+			err := history.Add(report)
+			if err != nil {
+				fatal(fmt.Errorf("recording report: %w", err))
+			}
 		}
-		if opts.Target != "" {
-			logger.Debug(
-				"Ignoring target from command line",
-				"target",
-				opts.Target,
-			)
+		if opts.MetricsAddr != "" {
+			metrics.Add(report)
 		}
-		proto := protocols[0]
-		ch := make(chan int, targetConcurrency)
-		for _, part := range parts {
-			if part == "" {
-				logger.Debug("Empty part, skipping")
-				continue
+		var transition *probe.Transition
+		if opts.Monitor || len(hooks.Notifiers) > 0 {
+			transition = monitor.Add(report)
+		}
+		if transition != nil && len(hooks.Notifiers) > 0 {
+			select {
+			case transitionCh <- transition:
+			default:
+				logger.Error(
+					"Dropping notification, too many pending",
+					"message", transition.Message(),
+				)
 			}
-			wg.Add(1)
-			target := strings.TrimSpace(part)
-			go func(tg string) {
-				defer func() { wg.Done(); <-ch }()
-				select {
-				case <-ctx.Done():
-					logger.Debug("Context cancelled", "target", tg)
-					return
-				default:
-					probe := internal.Probe{
-						Proto:    proto,
-						Count:    opts.Count,
-						Delay:    opts.Delay,
-						Logger:   logger,
-						ReportCh: reportCh,
-						Target:   target,
-					}
-					logger.Debug("Running ...", "setup", probe)
-					err = probe.Do(ctx)
-					if err != nil {
-						fatal(
-							fmt.Errorf(
-								"running probe for target %s: %w",
-								target,
-								err,
-							),
-						)
-					}
+		}
+		if opts.Monitor {
+			if transition != nil {
+				line, err := transition.String(format)
+				if err != nil {
+					fatal(err)
 				}
-			}(target)
-		}
-	} else {
-		for _, protocol := range protocols {
-			wg.Add(1)
-			go func(proto internal.Protocol) {
-				defer wg.Done()
-				select {
-				case <-ctx.Done():
-					logger.Debug("Context cancelled", "protocol", proto)
-					return
-				default:
-					probe := internal.Probe{
-						Proto:    proto,
-						Count:    opts.Count,
-						Delay:    opts.Delay,
-						Logger:   logger,
-						ReportCh: reportCh,
-						Target:   opts.Target,
-					}
-					logger.Debug("Running ...", "setup", probe)
-					err = probe.Do(ctx)
-					if err != nil {
-						fatal(fmt.Errorf("running probe for protocol %s: %w", proto, err))
-					}
+				fmt.Println(line)
+			}
+		} else {
+			repLine, err := report.String(format)
+			if err != nil {
+				fatal(err)
+			}
+			fmt.Println(repLine)
+		}
+		if report.Succeeded() {
+			if opts.Stop {
+				logger.Debug("Stopping after first successful request")
+				cancel()
+			}
+		}
+	})
+	close(transitionCh)
+	if err != nil {
+		fatal(fmt.Errorf("running probes: %w", err))
+	}
+	logger.Debug("Waiting for the notifications ...")
+	<-notifyDone
+	summary, err := stats.String(format)
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Println(summary)
+	if !stats.Succeeded(opts.All, opts.Ratio) {
+		logger.Debug("Requirements not met", "all", opts.All, "ratio", opts.Ratio)
+		cancel()
+		os.Exit(exitNoResponse)
+	}
+}
+
+// Returns the probes of every protocol and target through each network
+// interface, labelled with it. The defaults are used for the rest of the
+// properties.
+func interfaceProbes(
+	defaults probe.Probe, protocolIDs, targets []string,
+	settings probe.Settings, ifaces []string,
+) ([]*probe.Probe, error) {
+	if len(targets) == 0 {
+		targets = []string{""}
+	}
+	var probes []*probe.Probe
+	for _, iface := range ifaces {
+		s := settings
+		s.Bind.Interface = iface
+		for _, id := range protocolIDs {
+			for _, target := range targets {
+				proto, err := probe.NewProtocol(id, s)
+				if err != nil {
+					return nil, err
 				}
-			}(protocol)
+				p := defaults
+				p.Proto, p.Target, p.Interface = proto, target, iface
+				probes = append(probes, &p)
+			}
 		}
 	}
-	wg.Wait()
+	return probes, nil
+}
+
+// Prints the availability of the protocols and targets stored in the history.
+func runHistory(args []string) {
+	var opts internal.HistoryOptions
+	checkOptions(opts.Parse(args))
+	if opts.NoColor {
+		color.NoColor = true
+	}
+	history := probe.History{Path: opts.Path}
+	records, err := history.Query(opts.Query(time.Now()))
+	if err != nil {
+		fatal(err)
+	}
+	if len(records) == 0 {
+		fatal(errors.New("no reports found in the history"))
+	}
+	format := probe.HumanFormat
+	switch {
+	case opts.JSONOutput:
+		format = probe.JSONFormat
+	case opts.GrepOutput:
+		format = probe.GrepFormat
+	}
+	out, err := probe.NewUptimes(records, opts.Step).String(format)
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Println(out)
+}
+
+// Prints the public servers used by default.
+func runServers(args []string) {
+	var opts internal.ServersOptions
+	checkOptions(opts.Parse(args))
+	format := probe.HumanFormat
+	switch {
+	case opts.JSONOutput:
+		format = probe.JSONFormat
+	case opts.GrepOutput:
+		format = probe.GrepFormat
+	}
+	servers := internal.Servers(opts.Kind)
+	if len(servers) == 0 {
+		fatal(fmt.Errorf("unknown kind of server: %s", opts.Kind))
+	}
+	out, err := internal.ServersString(servers, format)
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Println(out)
+}
+
+// Exits if parsing the options failed: with status 0 if the usage was
+// requested, already printed.
+func checkOptions(err error) {
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fatal(fmt.Errorf("parsing options: %w", err))
+	}
 }
 
 // Prints the error to the standard output and exits with status 1.
@@ -0,0 +1,115 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Bind is the local end of the connections of a protocol. The zero value lets
+// the system choose it.
+type Bind struct {
+	// Optional. Source IP address.
+	IP net.IP
+	// Optional. Name of the network interface, only supported on Linux.
+	// Example: "wlan0".
+	Interface string
+}
+
+// String returns the source address and/or the interface. Example:
+// '192.168.1.10%wlan0'.
+func (b Bind) String() string {
+	switch {
+	case b.IP == nil:
+		return b.Interface
+	case b.Interface == "":
+		return b.IP.String()
+	default:
+		return b.IP.String() + "%" + b.Interface
+	}
+}
+
+// Returns true if the system chooses the local end.
+func (b Bind) isZero() bool {
+	return b.IP == nil && b.Interface == ""
+}
+
+// Returns a dialer for the network ("tcp" or "udp", optionally restricted to
+// a family) with the local end set.
+func (b Bind) dialer(network string, timeout time.Duration) *net.Dialer {
+	d := &net.Dialer{Timeout: timeout}
+	if b.IP != nil {
+		if strings.HasPrefix(network, "udp") {
+			d.LocalAddr = &net.UDPAddr{IP: b.IP}
+		} else {
+			d.LocalAddr = &net.TCPAddr{IP: b.IP}
+		}
+	}
+	d.Control = b.control()
+	return d
+}
+
+// Returns an unconnected UDP socket, optionally restricted to a family, with
+// the local end set. The port is chosen by the system.
+func (b Bind) listenPacket(
+	ctx context.Context, f Family,
+) (net.PacketConn, error) {
+	lc := &net.ListenConfig{Control: b.control()}
+	addr := ":0"
+	if b.IP != nil {
+		addr = net.JoinHostPort(b.IP.String(), "0")
+	}
+	return lc.ListenPacket(ctx, f.network("udp"), addr)
+}
+
+// Returns the function binding the sockets to the interface, nil if not set.
+func (b Bind) control() func(network, address string, c syscall.RawConn) error {
+	if b.Interface == "" {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		ctrlErr := c.Control(func(fd uintptr) {
+			err = bindToDevice(fd, b.Interface)
+		})
+		err = errors.Join(ctrlErr, err)
+		if err != nil {
+			return fmt.Errorf("binding to interface %s: %w", b.Interface, err)
+		}
+		return nil
+	}
+}
+
+// Returns a dial function restricted to the family, with the local end set.
+func (b Bind) dialContext(
+	f Family,
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return b.dialer(network, 0).DialContext(ctx, f.network(network), addr)
+	}
+}
+
+// Interfaces returns the names of the network interfaces which are up and
+// have an address, except the loopback ones.
+func Interfaces() ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("listing network interfaces: %w", err)
+	}
+	var names []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil || len(addrs) == 0 {
+			continue
+		}
+		names = append(names, iface.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,128 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBindString(t *testing.T) {
+	for _, tt := range []struct {
+		bind Bind
+		want string
+	}{
+		{Bind{}, ""},
+		{Bind{IP: net.IPv4(127, 0, 0, 2)}, "127.0.0.2"},
+		{Bind{Interface: "lo"}, "lo"},
+		{Bind{IP: net.IPv4(127, 0, 0, 2), Interface: "lo"}, "127.0.0.2%lo"},
+	} {
+		t.Run("returns "+tt.want, func(t *testing.T) {
+			got := tt.bind.String()
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindProtocols(t *testing.T) {
+	tout := 1 * time.Second
+	if runtime.GOOS != "linux" {
+		t.Skip("127.0.0.0/8 is only routed through the loopback on Linux")
+	}
+	src := net.IPv4(127, 0, 0, 2)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("starting tcp server: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	t.Run("uses the source address (TCP)", func(t *testing.T) {
+		proto := &TCP{Timeout: tout, Bind: Bind{IP: src}}
+		res, err := proto.Probe(context.Background(), l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(res.TCP.LocalAddr, "127.0.0.2:") {
+			t.Fatalf("got %q, want the source address", res.TCP.LocalAddr)
+		}
+	})
+	t.Run("uses the source address (DNS)", func(t *testing.T) {
+		srv := newTestDNSServer(t)
+		proto := &DNS{Timeout: tout, Resolver: srv.addr, Bind: Bind{IP: src}}
+		_, err := proto.Probe(context.Background(), "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Not routable from the loopback interface.
+		proto.Bind.IP = net.IPv4(192, 0, 2, 1)
+		_, err = proto.Probe(context.Background(), "example.com")
+		if err == nil {
+			t.Fatal("got nil, want an error")
+		}
+	})
+	t.Run("uses the source address (HTTP)", func(t *testing.T) {
+		backend := newTestBackend(t)
+		proto := &HTTP{Timeout: tout, Direct: true, Bind: Bind{IP: src}}
+		_, err := proto.Probe(context.Background(), backend.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("uses the source address (HTTP/3)", func(t *testing.T) {
+		target, roots := newTestHTTP3Server(t, true)
+		proto := &HTTP3{Timeout: tout, RootCAs: roots, Bind: Bind{IP: src}}
+		res, err := proto.Probe(context.Background(), target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.HTTP3.Fallback {
+			t.Fatalf("got %+v, want the response over QUIC", res.HTTP3)
+		}
+	})
+	t.Run("binds to the interface", func(t *testing.T) {
+		proto := &TCP{Timeout: tout, Bind: Bind{Interface: "lo"}}
+		_, err := proto.Probe(context.Background(), l.Addr().String())
+		if err != nil {
+			t.Skipf("binding to an interface not permitted: %v", err)
+		}
+	})
+	t.Run("returns an error if the interface does not exist",
+		func(t *testing.T) {
+			proto := &TCP{Timeout: tout, Bind: Bind{Interface: "up-test0"}}
+			_, err := proto.Probe(context.Background(), l.Addr().String())
+			if err == nil || !strings.Contains(err.Error(), "binding to interface") {
+				t.Fatalf("got %v, want a binding error", err)
+			}
+		},
+	)
+}
+
+func TestInterfaces(t *testing.T) {
+	t.Run("skips the loopback interfaces", func(t *testing.T) {
+		got, err := Interfaces()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range got {
+			iface, err := net.InterfaceByName(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if iface.Flags&net.FlagLoopback != 0 {
+				t.Fatalf("got %q, want no loopback", name)
+			}
+		}
+	})
+}
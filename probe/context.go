@@ -0,0 +1,43 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Returns the context error if it is done, because it is the actual cause of
+// the network error.
+//
+// The deadline of the sockets is the one of the context, but it can expire
+// slightly earlier.
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if _, ok := ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// Closes the connection when the context is done, because blocking reads are
+// not aware of it, and sets the deadline of the context to the connection.
+//
+// The returned function stops the closing, as the one of context.AfterFunc.
+func closeOnDone(ctx context.Context, conn interface {
+	Close() error
+	SetDeadline(t time.Time) error
+}) (stop func() bool, err error) {
+	stop = context.AfterFunc(ctx, func() { conn.Close() })
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("setting deadline: %w", err)
+		}
+	}
+	return stop, nil
+}
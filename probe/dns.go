@@ -0,0 +1,496 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Default port of the DNS servers.
+const dnsPort = "53"
+
+// Default port of the DNS-over-TLS servers (RFC 7858).
+const dotPort = "853"
+
+// Media type of the DNS-over-HTTPS messages (RFC 8484).
+const dohMediaType = "application/dns-message"
+
+// Maximum size of the UDP responses announced to the servers (EDNS0).
+const dnsUDPSize = 1232
+
+// Path of the system resolver configuration, in Unix systems.
+const resolvConfPath = "/etc/resolv.conf"
+
+// Supported record types.
+var dnsTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"MX":    dnsmessage.TypeMX,
+	"TXT":   dnsmessage.TypeTXT,
+	"NS":    dnsmessage.TypeNS,
+	"CNAME": dnsmessage.TypeCNAME,
+	"SOA":   dnsmessage.TypeSOA,
+}
+
+// Names of the response codes (RFC 1035, 4.1.1).
+var dnsRcodes = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+// ErrDNSRcode is returned when the server answers with an error code.
+var ErrDNSRcode = errors.New("DNS error response")
+
+// DNS protocol implementation.
+type DNS struct {
+	Timeout time.Duration
+	// Optional. IP address family to use. Any by default.
+	Family Family
+	// Optional. Local end of the connections. The system chooses it by
+	// default.
+	Bind Bind
+	// Custom DNS resolver. The first one of the system configuration
+	// (/etc/resolv.conf) by default, or a random public one if it is
+	// missing, as in Windows.
+	// - Plain DNS: host or host:port.
+	// - DNS-over-TLS: 'tls://host' or 'tls://host:port'.
+	// - DNS-over-HTTPS: URL of the endpoint, as
+	// 'https://cloudflare-dns.com/dns-query'.
+	// A random public server is used if the host is missing (ie: 'tls://').
+	Resolver string
+	// Optional. Record type to query. "A" by default.
+	Type string
+	// Optional. HTTP method for DNS-over-HTTPS, "GET" or "POST" (default).
+	DoHMethod string
+	// Optional. Certificate authorities to trust in the encrypted
+	// transports. The system ones by default.
+	RootCAs *x509.CertPool
+	// Resolve the domain using every resolver in parallel, to detect the ones
+	// answering differently. The Resolver is ignored.
+	Compare bool
+	// Optional. Resolvers to compare, in any of the Resolver formats. The
+	// public ones of the family (Resolvers or ResolversIPv6) by default.
+	Resolvers []string
+}
+
+// String returns the identifier of the protocol.
+func (d *DNS) String() string {
+	return "dns"
+}
+
+// Probe queries a random domain name.
+//
+// The target is a domain name.
+// The result includes the response code, the answers and the server which
+// responded. It is also returned if the response code is an error one
+// (ie: NXDOMAIN), wrapped in ErrDNSRcode.
+// In compare mode the result includes the answers of every resolver, and it is
+// also returned with ErrDNSMismatch if any of them disagree.
+// Plain DNS uses UDP, falling back to TCP if the response is truncated.
+func (d *DNS) Probe(ctx context.Context, target string) (*Result, error) {
+	qType := dnsmessage.TypeA
+	if d.Type != "" {
+		var ok bool
+		qType, ok = dnsTypes[strings.ToUpper(d.Type)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported record type: %s", d.Type)
+		}
+	}
+	domain := target
+	if domain == "" {
+		var err error
+		domain, err = RandomDomain()
+		if err != nil {
+			return nil, fmt.Errorf("selecting domain: %w", err)
+		}
+	}
+	if d.Compare {
+		return d.compare(ctx, domain, qType)
+	}
+	res, err := d.query(ctx, domain, qType)
+	if res == nil {
+		return nil, err
+	}
+	return &Result{Target: domain, DNS: res}, err
+}
+
+// Resolves the domain using the configured resolver.
+//
+// The result is also returned with ErrDNSRcode.
+func (d *DNS) query(
+	ctx context.Context, domain string, qType dnsmessage.Type,
+) (*DNSResult, error) {
+	transport, server, err := d.server()
+	if err != nil {
+		return nil, fmt.Errorf("selecting DNS server: %w", err)
+	}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	query, err := newDNSQuery(domain, qType)
+	if err != nil {
+		return nil, fmt.Errorf("building query: %w", err)
+	}
+	var resp *dnsmessage.Message
+	switch transport {
+	case "https":
+		resp, err = d.exchangeHTTPS(ctx, server, query)
+	case "tls":
+		resp, err = d.exchangeTLS(ctx, server, query)
+	default:
+		resp, err = dnsExchange(
+			ctx, d.Bind, d.Family.network("udp"), server, query,
+		)
+		if err == nil && resp.Truncated {
+			transport = "tcp"
+			resp, err = dnsExchange(
+				ctx, d.Bind, d.Family.network("tcp"), server, query,
+			)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := newDNSResult(resp)
+	res.Server = server
+	res.Transport = transport
+	if resp.RCode != dnsmessage.RCodeSuccess {
+		return res, fmt.Errorf("%w: %s", ErrDNSRcode, res.Rcode)
+	}
+	return res, nil
+}
+
+// Returns the transport ("udp", "tls" or "https") and the address of the
+// server to query: a host:port, or a URL for DNS-over-HTTPS.
+func (d *DNS) server() (string, string, error) {
+	switch {
+	case d.Resolver == "https://":
+		server, err := RandomDoHServer()
+		return "https", server, err
+	case strings.HasPrefix(d.Resolver, "https://"):
+		return "https", d.Resolver, nil
+	case d.Resolver == "tls://":
+		server, err := RandomDoTServer()
+		return "tls", server, err
+	case strings.HasPrefix(d.Resolver, "tls://"):
+		host := strings.TrimPrefix(d.Resolver, "tls://")
+		return "tls", withDefaultPort(host, dotPort), nil
+	case d.Resolver != "":
+		return "udp", withDefaultPort(d.Resolver, dnsPort), nil
+	}
+	server := systemResolver(d.Family)
+	if server != "" {
+		return "udp", net.JoinHostPort(server, dnsPort), nil
+	}
+	server, err := randomTCPServer(d.Family)
+	return "udp", server, err
+}
+
+// Adds the port to the host if it does not include one.
+func withDefaultPort(host, port string) string {
+	_, _, err := net.SplitHostPort(host)
+	if err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+// Returns the first name server of the system configuration in the family,
+// empty if it is not available.
+func systemResolver(family Family) string {
+	f, err := os.Open(resolvConfPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		// Without the zone of the link-local addresses.
+		host, _, _ := strings.Cut(fields[1], "%")
+		ip := net.ParseIP(host)
+		if ip != nil && family.matches(ip) {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// Returns a recursive query asking for the authenticated data (AD) bit.
+func newDNSQuery(domain string, qType dnsmessage.Type) (*dnsmessage.Message, error) {
+	if !strings.HasSuffix(domain, ".") {
+		domain += "."
+	}
+	name, err := dnsmessage.NewName(domain)
+	if err != nil {
+		return nil, err
+	}
+	id, err := rand.Int(rand.Reader, big.NewInt(1<<16))
+	if err != nil {
+		return nil, fmt.Errorf(tmplRandom, err)
+	}
+	var opt dnsmessage.ResourceHeader
+	err = opt.SetEDNS0(dnsUDPSize, dnsmessage.RCodeSuccess, false)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               uint16(id.Int64()),
+			RecursionDesired: true,
+			AuthenticData:    true,
+		},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: qType, Class: dnsmessage.ClassINET},
+		},
+		Additionals: []dnsmessage.Resource{
+			{Header: opt, Body: &dnsmessage.OPTResource{}},
+		},
+	}, nil
+}
+
+// Sends the query to the server and returns its response.
+//
+// The network is "udp" or "tcp", optionally restricted to a family (ie:
+// "udp6").
+func dnsExchange(
+	ctx context.Context, bind Bind, network, server string,
+	query *dnsmessage.Message,
+) (*dnsmessage.Message, error) {
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("packing query: %w", err)
+	}
+	if strings.HasPrefix(network, "udp") {
+		var resp dnsmessage.Message
+		// Malformed packets are ignored too.
+		_, err = udpExchange(ctx, bind, network, server, packed,
+			func(req, reply []byte) bool {
+				return isDNSReply(req, reply) && resp.Unpack(reply) == nil
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		return &resp, nil
+	}
+	conn, err := bind.dialer(network, 0).DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop, err := closeOnDone(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	return dnsExchangeStream(ctx, conn, query.ID, packed)
+}
+
+// Sends the query to a DNS-over-TLS server (host:port).
+func (d *DNS) exchangeTLS(
+	ctx context.Context, server string, query *dnsmessage.Message,
+) (*dnsmessage.Message, error) {
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("packing query: %w", err)
+	}
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return nil, fmt.Errorf("parsing server address: %w", err)
+	}
+	network := d.Family.network("tcp")
+	dialer := tls.Dialer{
+		NetDialer: d.Bind.dialer(network, 0),
+		Config: &tls.Config{
+			ServerName: host,
+			RootCAs:    d.RootCAs,
+		},
+	}
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop, err := closeOnDone(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	return dnsExchangeStream(ctx, conn, query.ID, packed)
+}
+
+// Sends the query to a DNS-over-HTTPS endpoint (RFC 8484).
+func (d *DNS) exchangeHTTPS(
+	ctx context.Context, endpoint string, query *dnsmessage.Message,
+) (*dnsmessage.Message, error) {
+	// Zero is recommended to improve caching (RFC 8484, 4.1).
+	query.ID = 0
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("packing query: %w", err)
+	}
+	var req *http.Request
+	switch strings.ToUpper(d.DoHMethod) {
+	case "", http.MethodPost:
+		req, err = http.NewRequestWithContext(
+			ctx, http.MethodPost, endpoint, bytes.NewReader(packed),
+		)
+		if err == nil {
+			req.Header.Set("Content-Type", dohMediaType)
+		}
+	case http.MethodGet:
+		var u *url.URL
+		u, err = url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("parsing endpoint: %w", err)
+		}
+		params := u.Query()
+		params.Set("dns", base64.RawURLEncoding.EncodeToString(packed))
+		u.RawQuery = params.Encode()
+		req, err = http.NewRequestWithContext(
+			ctx, http.MethodGet, u.String(), nil,
+		)
+	default:
+		return nil, fmt.Errorf("unsupported DoH method: %s", d.DoHMethod)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Accept", dohMediaType)
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DisableKeepAlives = true
+	tr.TLSClientConfig = &tls.Config{RootCAs: d.RootCAs}
+	if d.Family != FamilyAny || !d.Bind.isZero() {
+		tr.DialContext = d.Bind.dialContext(d.Family)
+	}
+	resp, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+	// Maximum size of a DNS message.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	var msg dnsmessage.Message
+	err = msg.Unpack(body)
+	if err != nil {
+		return nil, fmt.Errorf("unpacking response: %w", err)
+	}
+	if msg.ID != query.ID {
+		return nil, errors.New("unexpected response identifier")
+	}
+	return &msg, nil
+}
+
+// Sends the query using a stream connection, where messages are prefixed
+// with their length (RFC 1035, 4.2.2).
+func dnsExchangeStream(
+	ctx context.Context, conn io.ReadWriter, id uint16, packed []byte,
+) (*dnsmessage.Message, error) {
+	msg := binary.BigEndian.AppendUint16(nil, uint16(len(packed)))
+	_, err := conn.Write(append(msg, packed...))
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	var length uint16
+	err = binary.Read(conn, binary.BigEndian, &length)
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	buf := make([]byte, length)
+	_, err = io.ReadFull(conn, buf)
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	var resp dnsmessage.Message
+	err = resp.Unpack(buf)
+	if err != nil {
+		return nil, fmt.Errorf("unpacking response: %w", err)
+	}
+	if resp.ID != id {
+		return nil, errors.New("unexpected response identifier")
+	}
+	return &resp, nil
+}
+
+// Returns the information of a response.
+func newDNSResult(resp *dnsmessage.Message) *DNSResult {
+	res := &DNSResult{
+		Rcode:         dnsRcodes[resp.RCode],
+		Authenticated: resp.AuthenticData,
+	}
+	if res.Rcode == "" {
+		res.Rcode = strings.TrimPrefix(resp.RCode.String(), "RCode")
+	}
+	for _, answer := range resp.Answers {
+		data := dnsData(answer.Body)
+		res.Answers = append(res.Answers, DNSAnswer{
+			Name: answer.Header.Name.String(),
+			Type: strings.TrimPrefix(answer.Header.Type.String(), "Type"),
+			TTL:  answer.Header.TTL,
+			Data: data,
+		})
+		switch answer.Header.Type {
+		case dnsmessage.TypeA, dnsmessage.TypeAAAA:
+			res.Addrs = append(res.Addrs, data)
+		}
+	}
+	return res
+}
+
+// Returns the data of a record in presentation format.
+func dnsData(body dnsmessage.ResourceBody) string {
+	switch b := body.(type) {
+	case *dnsmessage.AResource:
+		return net.IP(b.A[:]).String()
+	case *dnsmessage.AAAAResource:
+		return net.IP(b.AAAA[:]).String()
+	case *dnsmessage.MXResource:
+		return fmt.Sprintf("%d %s", b.Pref, b.MX)
+	case *dnsmessage.TXTResource:
+		return strings.Join(b.TXT, "")
+	case *dnsmessage.NSResource:
+		return b.NS.String()
+	case *dnsmessage.CNAMEResource:
+		return b.CNAME.String()
+	case *dnsmessage.SOAResource:
+		return fmt.Sprintf(
+			"%s %s %d %d %d %d %d", b.NS, b.MBox, b.Serial, b.Refresh,
+			b.Retry, b.Expire, b.MinTTL,
+		)
+	default:
+		return body.GoString()
+	}
+}
@@ -0,0 +1,444 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestDNSProbe(t *testing.T) {
+	tout := 1 * time.Second
+	server := newTestDNSServer(t)
+	t.Run(
+		"returns the domain if the request is successful",
+		func(t *testing.T) {
+			proto := &DNS{Timeout: tout, Resolver: server.addr}
+			domain := "example.com"
+			res, err := proto.Probe(context.Background(), domain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Target != domain {
+				t.Fatalf("got %q, want %q", res.Target, domain)
+			}
+			if res.DNS.Rcode != "NOERROR" {
+				t.Fatalf("got %q, want %q", res.DNS.Rcode, "NOERROR")
+			}
+			if len(res.DNS.Addrs) != 1 || res.DNS.Addrs[0] != "192.0.2.1" {
+				t.Fatalf("got %v, want %v", res.DNS.Addrs, []string{"192.0.2.1"})
+			}
+			want := DNSAnswer{
+				Name: "example.com.", Type: "A", TTL: 300, Data: "192.0.2.1",
+			}
+			if len(res.DNS.Answers) != 1 || res.DNS.Answers[0] != want {
+				t.Fatalf("got %v, want %v", res.DNS.Answers, want)
+			}
+			if !res.DNS.Authenticated {
+				t.Fatal("got false, want the AD bit")
+			}
+			if res.DNS.Server != server.addr {
+				t.Fatalf("got %q, want %q", res.DNS.Server, server.addr)
+			}
+			if res.DNS.Transport != "udp" {
+				t.Fatalf("got %q, want %q", res.DNS.Transport, "udp")
+			}
+		},
+	)
+	t.Run("queries other record types", func(t *testing.T) {
+		proto := &DNS{Timeout: tout, Resolver: server.addr, Type: "mx"}
+		res, err := proto.Probe(context.Background(), "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := DNSAnswer{
+			Name: "example.com.", Type: "MX", TTL: 60, Data: "10 mx.example.com.",
+		}
+		if len(res.DNS.Answers) != 1 || res.DNS.Answers[0] != want {
+			t.Fatalf("got %v, want %v", res.DNS.Answers, want)
+		}
+		if len(res.DNS.Addrs) != 0 {
+			t.Fatalf("got %v, want no addresses", res.DNS.Addrs)
+		}
+	})
+	t.Run("falls back to TCP if the response is truncated", func(t *testing.T) {
+		proto := &DNS{Timeout: tout, Resolver: server.addr}
+		res, err := proto.Probe(context.Background(), "truncated.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.DNS.Transport != "tcp" {
+			t.Fatalf("got %q, want %q", res.DNS.Transport, "tcp")
+		}
+		if len(res.DNS.Answers) != 1 {
+			t.Fatalf("got %d answers, want %d", len(res.DNS.Answers), 1)
+		}
+	})
+	t.Run("reads responses larger than the announced size", func(t *testing.T) {
+		proto := &DNS{Timeout: tout, Resolver: server.addr}
+		res, err := proto.Probe(context.Background(), "large.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.DNS.Transport != "udp" {
+			t.Fatalf("got %q, want %q", res.DNS.Transport, "udp")
+		}
+		if len(res.DNS.Answers) != 101 {
+			t.Fatalf("got %d answers, want %d", len(res.DNS.Answers), 101)
+		}
+	})
+	t.Run("queries DNS-over-HTTPS servers", func(t *testing.T) {
+		for _, method := range []string{"GET", "POST", ""} {
+			proto := &DNS{
+				Timeout:   tout,
+				Resolver:  server.doh,
+				DoHMethod: method,
+				RootCAs:   server.roots,
+			}
+			res, err := proto.Probe(context.Background(), "example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.DNS.Transport != "https" {
+				t.Fatalf("got %q, want %q", res.DNS.Transport, "https")
+			}
+			if res.DNS.Server != server.doh {
+				t.Fatalf("got %q, want %q", res.DNS.Server, server.doh)
+			}
+			if len(res.DNS.Addrs) != 1 || res.DNS.Addrs[0] != "192.0.2.1" {
+				t.Fatalf("got %v, want %v", res.DNS.Addrs, []string{"192.0.2.1"})
+			}
+		}
+	})
+	t.Run("returns an error if the DoH method is unknown", func(t *testing.T) {
+		proto := &DNS{Timeout: tout, Resolver: server.doh, DoHMethod: "PUT"}
+		_, err := proto.Probe(context.Background(), "example.com")
+		want := "unsupported DoH method: PUT"
+		if err == nil || err.Error() != want {
+			t.Fatalf("got %v, want %q", err, want)
+		}
+	})
+	t.Run("queries DNS-over-TLS servers", func(t *testing.T) {
+		proto := &DNS{
+			Timeout: tout, Resolver: "tls://" + server.dot, RootCAs: server.roots,
+		}
+		res, err := proto.Probe(context.Background(), "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.DNS.Transport != "tls" {
+			t.Fatalf("got %q, want %q", res.DNS.Transport, "tls")
+		}
+		if res.DNS.Server != server.dot {
+			t.Fatalf("got %q, want %q", res.DNS.Server, server.dot)
+		}
+		if len(res.DNS.Answers) != 1 {
+			t.Fatalf("got %d answers, want %d", len(res.DNS.Answers), 1)
+		}
+	})
+	t.Run(
+		"returns an error if the DNS-over-TLS certificate is not trusted",
+		func(t *testing.T) {
+			proto := &DNS{Timeout: tout, Resolver: "tls://" + server.dot}
+			_, err := proto.Probe(context.Background(), "example.com")
+			var certErr *tls.CertificateVerificationError
+			if !errors.As(err, &certErr) {
+				t.Fatalf("got %v, want a certificate error", err)
+			}
+		},
+	)
+	t.Run("returns the response code if it is an error", func(t *testing.T) {
+		proto := &DNS{Timeout: tout, Resolver: server.addr}
+		for domain, want := range map[string]string{
+			"invalid.aa":           "NXDOMAIN",
+			"servfail.example.com": "SERVFAIL",
+		} {
+			res, err := proto.Probe(context.Background(), domain)
+			if !errors.Is(err, ErrDNSRcode) {
+				t.Fatalf("got %v, want %v", err, ErrDNSRcode)
+			}
+			if err.Error() != "DNS error response: "+want {
+				t.Fatalf("got %q, want %q", err, want)
+			}
+			if res.DNS.Rcode != want {
+				t.Fatalf("got %q, want %q", res.DNS.Rcode, want)
+			}
+		}
+	})
+	t.Run("returns an error if the record type is unknown", func(t *testing.T) {
+		proto := &DNS{Timeout: tout, Resolver: server.addr, Type: "FOO"}
+		_, err := proto.Probe(context.Background(), "example.com")
+		want := "unsupported record type: FOO"
+		if err == nil || err.Error() != want {
+			t.Fatalf("got %v, want %q", err, want)
+		}
+	})
+	t.Run("returns an error if there is no response", func(t *testing.T) {
+		hung := newTestHungDNSServer(t)
+		proto := &DNS{Timeout: 50 * time.Millisecond, Resolver: hung}
+		res, err := proto.Probe(context.Background(), "example.com")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+		}
+		if res != nil {
+			t.Fatalf("got %v should be nil", res)
+		}
+	})
+	t.Run("aborts the lookup if the context is cancelled", func(t *testing.T) {
+		hung := newTestHungDNSServer(t)
+		proto := &DNS{Timeout: time.Minute, Resolver: hung}
+		_, err := proto.Probe(cancelSoon(t), "example.com")
+		assertCancelled(t, err)
+	})
+}
+
+// DNS server for testing, listening on UDP and TCP in the same port, and
+// with DNS-over-HTTPS and DNS-over-TLS endpoints.
+//
+// Answers with fixed records depending on the queried name:
+// - "invalid.aa.": NXDOMAIN.
+// - "servfail.example.com.": SERVFAIL.
+// - "truncated.example.com.": truncated over UDP.
+// - Anything else: an A (the given address) or MX record, setting the AD
+// bit.
+type testDNSServer struct {
+	// Plain DNS host:port.
+	addr string
+	// DNS-over-HTTPS URL.
+	doh string
+	// DNS-over-TLS host:port.
+	dot string
+	// Trusting the certificate of the encrypted endpoints.
+	roots *x509.CertPool
+}
+
+func newTestDNSServer(t *testing.T) *testDNSServer {
+	return newTestDNSServerAnswering(t, [4]byte{192, 0, 2, 1})
+}
+
+func newTestDNSServerAnswering(t *testing.T, a [4]byte) *testDNSServer {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("starting DNS server: %v", err)
+	}
+	t.Cleanup(func() { udp.Close() })
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("starting DNS server: %v", err)
+	}
+	t.Cleanup(func() { tcp.Close() })
+	doh := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var query []byte
+			var err error
+			switch r.Method {
+			case http.MethodGet:
+				query, err = base64.RawURLEncoding.DecodeString(
+					r.URL.Query().Get("dns"),
+				)
+			case http.MethodPost:
+				query, err = io.ReadAll(r.Body)
+			}
+			if err != nil || r.Header.Get("Accept") != dohMediaType {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", dohMediaType)
+			w.Write(testDNSResponse(t, query, a, false))
+		},
+	))
+	t.Cleanup(doh.Close)
+	dot, err := tls.Listen("tcp", "127.0.0.1:0", doh.TLS)
+	if err != nil {
+		t.Fatalf("starting DNS server: %v", err)
+	}
+	t.Cleanup(func() { dot.Close() })
+	for _, l := range []net.Listener{tcp, dot} {
+		go serveTestDNSStream(t, l, a)
+	}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			resp := testDNSResponse(t, buf[:n], a, true)
+			udp.WriteTo(resp, addr)
+		}
+	}()
+	roots := x509.NewCertPool()
+	roots.AddCert(doh.Certificate())
+	return &testDNSServer{
+		addr:  udp.LocalAddr().String(),
+		doh:   doh.URL + "/dns-query",
+		dot:   dot.Addr().String(),
+		roots: roots,
+	}
+}
+
+// Answers the queries of the stream connections, with messages prefixed by
+// their length.
+func serveTestDNSStream(t *testing.T, l net.Listener, a [4]byte) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			var length uint16
+			err := binary.Read(conn, binary.BigEndian, &length)
+			if err != nil {
+				return
+			}
+			buf := make([]byte, length)
+			_, err = io.ReadFull(conn, buf)
+			if err != nil {
+				return
+			}
+			resp := testDNSResponse(t, buf, a, false)
+			msg := binary.BigEndian.AppendUint16(nil, uint16(len(resp)))
+			conn.Write(append(msg, resp...))
+		}()
+	}
+}
+
+// Returns the packed response to a query, answering A queries with the given
+// address.
+func testDNSResponse(t *testing.T, packed []byte, a [4]byte, udp bool) []byte {
+	var query dnsmessage.Message
+	err := query.Unpack(packed)
+	if err != nil {
+		t.Errorf("unpacking query: %v", err)
+		return nil
+	}
+	q := query.Questions[0]
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 query.ID,
+			Response:           true,
+			RecursionAvailable: true,
+		},
+		Questions: query.Questions,
+	}
+	switch q.Name.String() {
+	case "invalid.aa.":
+		resp.RCode = dnsmessage.RCodeNameError
+	case "servfail.example.com.":
+		resp.RCode = dnsmessage.RCodeServerFailure
+	case "truncated.example.com.":
+		if udp {
+			resp.Truncated = true
+			break
+		}
+		fallthrough
+	default:
+		resp.AuthenticData = query.AuthenticData
+		header := dnsmessage.ResourceHeader{
+			Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 300,
+		}
+		var body dnsmessage.ResourceBody = &dnsmessage.AResource{A: a}
+		if q.Type == dnsmessage.TypeMX {
+			header.TTL = 60
+			body = &dnsmessage.MXResource{
+				Pref: 10, MX: dnsmessage.MustNewName("mx.example.com."),
+			}
+		}
+		resp.Answers = []dnsmessage.Resource{{Header: header, Body: body}}
+		// Larger than the size announced by the client.
+		if q.Name.String() == "large.example.com." {
+			for range 100 {
+				resp.Answers = append(resp.Answers, resp.Answers[0])
+			}
+		}
+	}
+	out, err := resp.Pack()
+	if err != nil {
+		t.Errorf("packing response: %v", err)
+	}
+	return out
+}
+
+// Creates a DNS server for testing that never answers.
+//
+// Returns its address.
+func newTestHungDNSServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("starting DNS server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn.LocalAddr().String()
+}
+
+func TestDNSServer(t *testing.T) {
+	tests := []struct {
+		resolver  string
+		transport string
+		server    string
+	}{
+		{"1.1.1.1", "udp", "1.1.1.1:53"},
+		{"tls://1.1.1.1", "tls", "1.1.1.1:853"},
+		{"tls://dns.google:8853", "tls", "dns.google:8853"},
+		{
+			"https://dns.google/dns-query",
+			"https",
+			"https://dns.google/dns-query",
+		},
+	}
+	for _, tt := range tests {
+		d := &DNS{Resolver: tt.resolver}
+		transport, server, err := d.server()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if transport != tt.transport || server != tt.server {
+			t.Fatalf(
+				"got %q %q, want %q %q",
+				transport, server, tt.transport, tt.server,
+			)
+		}
+	}
+	t.Run("selects a random public server if the host is missing", func(t *testing.T) {
+		for resolver, want := range map[string]string{
+			"tls://":   "tls",
+			"https://": "https",
+		} {
+			d := &DNS{Resolver: resolver}
+			transport, server, err := d.server()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if transport != want || server == "" {
+				t.Fatalf("got %q %q, want a %s server", transport, server, want)
+			}
+		}
+	})
+}
+
+func TestWithDefaultPort(t *testing.T) {
+	for host, want := range map[string]string{
+		"1.1.1.1":           "1.1.1.1:53",
+		"1.1.1.1:5353":      "1.1.1.1:5353",
+		"2606:4700::1111":   "[2606:4700::1111]:53",
+		"[2606:4700::1111]": "[2606:4700::1111]:53",
+		"[::1]:5353":        "[::1]:5353",
+		"dns.example.com":   "dns.example.com:53",
+	} {
+		got := withDefaultPort(host, dnsPort)
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ErrDNSMismatch is returned when some resolvers answer differently than most
+// of them, with another response code or private addresses, a likely sign of
+// DNS interception or poisoning.
+var ErrDNSMismatch = errors.New("resolvers disagree")
+
+// Resolves the domain against every resolver in parallel.
+//
+// The answers of the majority are taken as the valid ones. Answers sharing any
+// record agree, as the geo-balanced domains return different records from
+// each resolver. The ones without common records are only a mismatch if the
+// response code is different or they point to private addresses, as the DNS
+// interception does, being inconclusive otherwise. Resolvers which fail are
+// not taken into account.
+func (d *DNS) compare(
+	ctx context.Context, domain string, qType dnsmessage.Type,
+) (*Result, error) {
+	resolvers := d.Resolvers
+	if len(resolvers) == 0 {
+		for _, ip := range familyResolvers(d.Family) {
+			resolvers = append(resolvers, ip.String())
+		}
+	}
+	answers := make([]DNSResolverAnswer, len(resolvers))
+	results := make([]*DNSResult, len(resolvers))
+	var wg sync.WaitGroup
+	for i, resolver := range resolvers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			single := *d
+			single.Resolver = resolver
+			start := time.Now()
+			res, err := single.query(ctx, domain, qType)
+			answers[i] = DNSResolverAnswer{
+				Resolver: resolver,
+				RTT:      time.Since(start),
+			}
+			if res == nil {
+				answers[i].Error = err.Error()
+				return
+			}
+			results[i] = res
+			answers[i].Rcode = res.Rcode
+			answers[i].Data = res.data()
+		}()
+	}
+	wg.Wait()
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	// Answer agreeing with most of the others.
+	consensus, votes := -1, 0
+	for i := range answers {
+		if answers[i].Error != "" {
+			continue
+		}
+		n := 0
+		for j := range answers {
+			if answers[j].Error == "" && answers[i].agrees(&answers[j]) {
+				n++
+			}
+		}
+		if n > votes {
+			consensus, votes = i, n
+		}
+	}
+	if consensus < 0 {
+		return nil, errors.New("no resolver answered")
+	}
+	cmp := &DNSComparison{Answers: answers}
+	valid := answers[consensus]
+	for i := range answers {
+		answer := &answers[i]
+		switch {
+		case answer.Error != "" || answer.agrees(&valid):
+		case answer.Rcode != valid.Rcode || answer.private():
+			answer.Disagree = true
+			cmp.Disagreeing = append(cmp.Disagreeing, answer.Resolver)
+		default:
+			answer.Inconclusive = true
+		}
+	}
+	res := results[consensus]
+	res.Comparison = cmp
+	result := &Result{Target: domain, DNS: res}
+	if len(cmp.Disagreeing) > 0 {
+		return result, fmt.Errorf(
+			"%w: %s", ErrDNSMismatch, strings.Join(cmp.Disagreeing, ", "),
+		)
+	}
+	if res.Rcode != dnsRcodes[dnsmessage.RCodeSuccess] {
+		return result, fmt.Errorf("%w: %s", ErrDNSRcode, res.Rcode)
+	}
+	return result, nil
+}
+
+// Returns the sorted data of the answers, as they can come in any order.
+func (r *DNSResult) data() []string {
+	data := make([]string, 0, len(r.Answers))
+	for _, answer := range r.Answers {
+		data = append(data, answer.Data)
+	}
+	slices.Sort(data)
+	return data
+}
+
+// Returns true if both answers have the same response code and share any
+// record.
+func (a *DNSResolverAnswer) agrees(other *DNSResolverAnswer) bool {
+	if a.Rcode != other.Rcode {
+		return false
+	}
+	if len(a.Data) == 0 || len(other.Data) == 0 {
+		return len(a.Data) == len(other.Data)
+	}
+	return slices.ContainsFunc(a.Data, func(data string) bool {
+		_, found := slices.BinarySearch(other.Data, data)
+		return found
+	})
+}
+
+// Returns true if any of the records is an address of a local network.
+func (a *DNSResolverAnswer) private() bool {
+	return slices.ContainsFunc(a.Data, func(data string) bool {
+		ip := net.ParseIP(data)
+		return ip != nil && (ip.IsPrivate() || ip.IsLoopback() ||
+			ip.IsUnspecified() || ip.IsLinkLocalUnicast())
+	})
+}
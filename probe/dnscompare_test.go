@@ -0,0 +1,191 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDNSCompare(t *testing.T) {
+	tout := 1 * time.Second
+	honest := newTestDNSServer(t)
+	other := newTestDNSServer(t)
+	hijacker := newTestDNSServerAnswering(t, [4]byte{10, 0, 0, 1})
+	t.Run("returns the answers if all the resolvers agree", func(t *testing.T) {
+		proto := &DNS{
+			Timeout:   tout,
+			Compare:   true,
+			Resolvers: []string{honest.addr, other.addr},
+		}
+		res, err := proto.Probe(context.Background(), "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.DNS.Addrs) != 1 || res.DNS.Addrs[0] != "192.0.2.1" {
+			t.Fatalf("got %v, want %v", res.DNS.Addrs, []string{"192.0.2.1"})
+		}
+		cmp := res.DNS.Comparison
+		if len(cmp.Answers) != 2 {
+			t.Fatalf("got %d answers, want %d", len(cmp.Answers), 2)
+		}
+		for i, answer := range cmp.Answers {
+			if answer.Resolver != proto.Resolvers[i] {
+				t.Fatalf("got %q, want %q", answer.Resolver, proto.Resolvers[i])
+			}
+			if answer.RTT == 0 {
+				t.Fatalf("got %s, want > 0", answer.RTT)
+			}
+		}
+		if len(cmp.Disagreeing) != 0 {
+			t.Fatalf("got %v should be empty", cmp.Disagreeing)
+		}
+		want := "192.0.2.1 ad agree=2/2"
+		if res.Summary() != want {
+			t.Fatalf("got %q, want %q", res.Summary(), want)
+		}
+	})
+	t.Run(
+		"returns an error with the resolvers disagreeing with the majority",
+		func(t *testing.T) {
+			proto := &DNS{
+				Timeout:   tout,
+				Compare:   true,
+				Resolvers: []string{hijacker.addr, honest.addr, other.addr},
+			}
+			res, err := proto.Probe(context.Background(), "example.com")
+			if !errors.Is(err, ErrDNSMismatch) {
+				t.Fatalf("got %v, want %v", err, ErrDNSMismatch)
+			}
+			want := "resolvers disagree: " + hijacker.addr
+			if err.Error() != want {
+				t.Fatalf("got %q, want %q", err, want)
+			}
+			if res.DNS.Server != honest.addr {
+				t.Fatalf("got %q, want %q", res.DNS.Server, honest.addr)
+			}
+			answer := res.DNS.Comparison.Answers[0]
+			if !answer.Disagree {
+				t.Fatal("got false, want the hijacker to disagree")
+			}
+			if len(answer.Data) != 1 || answer.Data[0] != "10.0.0.1" {
+				t.Fatalf("got %v, want %v", answer.Data, []string{"10.0.0.1"})
+			}
+		},
+	)
+	t.Run(
+		"does not return an error if the records are rotated",
+		func(t *testing.T) {
+			rotated := newTestDNSServerAnswering(t, [4]byte{192, 0, 2, 2})
+			proto := &DNS{
+				Timeout:   tout,
+				Compare:   true,
+				Resolvers: []string{rotated.addr, honest.addr, other.addr},
+			}
+			res, err := proto.Probe(context.Background(), "example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			answer := res.DNS.Comparison.Answers[0]
+			if !answer.Inconclusive || answer.Disagree {
+				t.Fatalf("got %+v, want an inconclusive answer", answer)
+			}
+			if len(res.DNS.Comparison.Disagreeing) != 0 {
+				t.Fatalf(
+					"got %v should be empty", res.DNS.Comparison.Disagreeing,
+				)
+			}
+			want := "192.0.2.1 ad agree=2/3"
+			if res.Summary() != want {
+				t.Fatalf("got %q, want %q", res.Summary(), want)
+			}
+		},
+	)
+	t.Run(
+		"returns the response code if the majority agree on an error",
+		func(t *testing.T) {
+			proto := &DNS{
+				Timeout:   tout,
+				Compare:   true,
+				Resolvers: []string{honest.addr, other.addr},
+			}
+			res, err := proto.Probe(context.Background(), "invalid.aa")
+			if !errors.Is(err, ErrDNSRcode) {
+				t.Fatalf("got %v, want %v", err, ErrDNSRcode)
+			}
+			want := "NXDOMAIN agree=2/2"
+			if res.Summary() != want {
+				t.Fatalf("got %q, want %q", res.Summary(), want)
+			}
+		},
+	)
+	t.Run("ignores the resolvers which fail", func(t *testing.T) {
+		hung := newTestHungDNSServer(t)
+		proto := &DNS{
+			Timeout:   50 * time.Millisecond,
+			Compare:   true,
+			Resolvers: []string{hung, honest.addr},
+		}
+		res, err := proto.Probe(context.Background(), "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		answer := res.DNS.Comparison.Answers[0]
+		if answer.Error == "" || answer.Disagree {
+			t.Fatalf("got %+v, want a failed answer", answer)
+		}
+		want := "192.0.2.1 ad agree=1/2"
+		if res.Summary() != want {
+			t.Fatalf("got %q, want %q", res.Summary(), want)
+		}
+	})
+	t.Run("returns an error if no resolver answers", func(t *testing.T) {
+		proto := &DNS{
+			Timeout:   50 * time.Millisecond,
+			Compare:   true,
+			Resolvers: []string{newTestHungDNSServer(t)},
+		}
+		res, err := proto.Probe(context.Background(), "example.com")
+		if err == nil || err.Error() != "no resolver answered" {
+			t.Fatalf("got %v, want %q", err, "no resolver answered")
+		}
+		if res != nil {
+			t.Fatalf("got %v should be nil", res)
+		}
+	})
+	t.Run("aborts the lookups if the context is cancelled", func(t *testing.T) {
+		proto := &DNS{
+			Timeout:   time.Minute,
+			Compare:   true,
+			Resolvers: []string{newTestHungDNSServer(t)},
+		}
+		_, err := proto.Probe(cancelSoon(t), "example.com")
+		assertCancelled(t, err)
+	})
+}
+
+func TestDNSResolverAnswerAgrees(t *testing.T) {
+	answer := DNSResolverAnswer{
+		Rcode: "NOERROR", Data: []string{"192.0.2.1", "192.0.2.2"},
+	}
+	t.Run("returns true if any record is shared", func(t *testing.T) {
+		other := DNSResolverAnswer{
+			Rcode: "NOERROR", Data: []string{"192.0.2.2", "192.0.2.3"},
+		}
+		if !answer.agrees(&other) {
+			t.Fatal("got false, want true")
+		}
+	})
+	t.Run("returns false if no record is shared", func(t *testing.T) {
+		other := DNSResolverAnswer{Rcode: "NOERROR", Data: []string{"192.0.2.3"}}
+		if answer.agrees(&other) {
+			t.Fatal("got true, want false")
+		}
+	})
+	t.Run("returns false if the response code is different", func(t *testing.T) {
+		other := DNSResolverAnswer{Rcode: "NXDOMAIN"}
+		if answer.agrees(&other) {
+			t.Fatal("got true, want false")
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ErrCaptivePortal is returned when the response of a captive portal
+// detection URL is not the expected one, because something intercepted it.
+var ErrCaptivePortal = errors.New("captive portal detected")
+
+// Maximum size of the response body to check.
+const maxBodySize = 1 << 20
+
+// Expectation describes a valid HTTP response. The zero values match
+// anything.
+type Expectation struct {
+	// Status code. Example: 204.
+	Status int
+	// Text the body must contain.
+	Body string
+	// Regular expression the body must match.
+	BodyRegexp *regexp.Regexp
+	// Headers the response must include. An empty value only checks they are
+	// present.
+	Headers map[string]string
+}
+
+// Returns true if the expectation matches any response.
+func (e *Expectation) isZero() bool {
+	return e.Status == 0 && e.Body == "" && e.BodyRegexp == nil &&
+		len(e.Headers) == 0
+}
+
+// Returns an error describing the first mismatch, nil if the response is the
+// expected one.
+func (e *Expectation) check(resp *http.Response, body []byte) error {
+	if e.Status != 0 && resp.StatusCode != e.Status {
+		return fmt.Errorf(
+			"unexpected status: got %d, want %d", resp.StatusCode, e.Status,
+		)
+	}
+	for name, want := range e.Headers {
+		values, ok := resp.Header[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return fmt.Errorf("unexpected headers: missing %s", name)
+		}
+		got := strings.Join(values, ", ")
+		if want != "" && got != want {
+			return fmt.Errorf(
+				"unexpected header %s: got %q, want %q", name, got, want,
+			)
+		}
+	}
+	if e.Body != "" && !strings.Contains(string(body), e.Body) {
+		return fmt.Errorf("unexpected body: missing %q", e.Body)
+	}
+	if e.BodyRegexp != nil && !e.BodyRegexp.Match(body) {
+		return fmt.Errorf("unexpected body: no match for %q", e.BodyRegexp)
+	}
+	return nil
+}
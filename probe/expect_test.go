@@ -0,0 +1,74 @@
+package probe
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestExpectationCheck(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Server": []string{"up"}},
+	}
+	body := []byte("Success\n")
+	tests := []struct {
+		name   string
+		expect Expectation
+		want   string
+	}{
+		{"anything", Expectation{}, ""},
+		{
+			"the same response",
+			Expectation{
+				Status:     http.StatusOK,
+				Body:       "Success",
+				BodyRegexp: regexp.MustCompile(`^Succ`),
+				Headers:    map[string]string{"server": "up"},
+			},
+			"",
+		},
+		{
+			"a present header",
+			Expectation{Headers: map[string]string{"Server": ""}},
+			"",
+		},
+		{
+			"a different status",
+			Expectation{Status: http.StatusNoContent},
+			"unexpected status: got 200, want 204",
+		},
+		{
+			"a missing header",
+			Expectation{Headers: map[string]string{"Location": ""}},
+			"unexpected headers: missing Location",
+		},
+		{
+			"a different header",
+			Expectation{Headers: map[string]string{"Server": "nginx"}},
+			`unexpected header Server: got "up", want "nginx"`,
+		},
+		{
+			"a different body",
+			Expectation{Body: "success"},
+			`unexpected body: missing "success"`,
+		},
+		{
+			"a body not matching",
+			Expectation{BodyRegexp: regexp.MustCompile(`^$`)},
+			`unexpected body: no match for "^$"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run("checks "+tt.name, func(t *testing.T) {
+			err := tt.expect.check(resp, body)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
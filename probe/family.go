@@ -0,0 +1,196 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Family is the IP address family used by the protocols.
+type Family string
+
+const (
+	// Any family, as the system prefers.
+	FamilyAny Family = ""
+	// Only IPv4.
+	FamilyIPv4 Family = "4"
+	// Only IPv6.
+	FamilyIPv6 Family = "6"
+	// Both families side by side, to compare them. See DualStack.
+	FamilyBoth Family = "both"
+)
+
+// Time the IPv4 connection attempts wait for the IPv6 ones (RFC 8305, 5).
+const happyEyeballsDelay = 250 * time.Millisecond
+
+// ErrFamily is returned when only one of the address families works.
+var ErrFamily = errors.New("address family not working")
+
+// Returns an error if the family is not supported.
+func (f Family) validate() error {
+	switch f {
+	case FamilyAny, FamilyIPv4, FamilyIPv6, FamilyBoth:
+		return nil
+	default:
+		return fmt.Errorf("unsupported address family: %s", f)
+	}
+}
+
+// Returns the network restricted to the family. Example: "tcp4".
+func (f Family) network(network string) string {
+	switch f {
+	case FamilyIPv4, FamilyIPv6:
+		return network + string(f)
+	default:
+		return network
+	}
+}
+
+// Returns true if the IP address belongs to the family.
+func (f Family) matches(ip net.IP) bool {
+	switch f {
+	case FamilyIPv4:
+		return ip.To4() != nil
+	case FamilyIPv6:
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
+
+// DualStack runs a protocol over IPv4 and IPv6 side by side.
+//
+// The result compares both families, as a client using Happy Eyeballs
+// (RFC 8305) would choose between them.
+type DualStack struct {
+	// Restricted to IPv4.
+	IPv4 Protocol
+	// Restricted to IPv6.
+	IPv6 Protocol
+}
+
+// String returns the identifier of the protocol.
+func (d *DualStack) String() string {
+	return d.IPv4.String()
+}
+
+// Probe makes an attempt using each family at the same time.
+//
+// Without target, the same random public server is used for both families,
+// as the protocol would choose it.
+// The result is also returned, wrapped in ErrFamily, if only one of them
+// works.
+func (d *DualStack) Probe(ctx context.Context, target string) (*Result, error) {
+	targets := [2]string{target, target}
+	if target == "" {
+		var err error
+		targets[0], targets[1], err = dualStackTargets(d.IPv4)
+		if err != nil {
+			return nil, err
+		}
+	}
+	res := &DualStackResult{IPv4: &FamilyResult{}, IPv6: &FamilyResult{}}
+	families := [2]*FamilyResult{res.IPv4, res.IPv6}
+	var wg sync.WaitGroup
+	for i, proto := range [2]Protocol{d.IPv4, d.IPv6} {
+		fres := families[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			r, err := proto.Probe(ctx, targets[i])
+			fres.RTT = time.Since(start)
+			fres.Result = r
+			if err != nil {
+				fres.Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	v4, v6 := res.IPv4.Error == "", res.IPv6.Error == ""
+	switch {
+	case v6 && (!v4 || res.IPv6.RTT <= res.IPv4.RTT+happyEyeballsDelay):
+		res.Preferred = FamilyIPv6
+	case v4:
+		res.Preferred = FamilyIPv4
+	default:
+		return nil, fmt.Errorf(
+			"IPv4: %s, IPv6: %s", res.IPv4.Error, res.IPv6.Error,
+		)
+	}
+	if target == "" {
+		target = res.family(res.Preferred).Result.Target
+	}
+	result := &Result{Target: target, DualStack: res}
+	switch {
+	case !v4:
+		return result, fmt.Errorf("%w: IPv4: %s", ErrFamily, res.IPv4.Error)
+	case !v6:
+		return result, fmt.Errorf("%w: IPv6: %s", ErrFamily, res.IPv6.Error)
+	}
+	return result, nil
+}
+
+// Returns the IPv4 and IPv6 targets of a random public server, as the
+// protocol would choose it. The servers chosen by address have one of each
+// family. Empty for the unknown protocols, which choose it on their own.
+func dualStackTargets(proto Protocol) (string, string, error) {
+	var target string
+	var err error
+	switch p := proto.(type) {
+	case *HTTP:
+		var portal *CaptivePortal
+		portal, err = RandomCaptivePortal()
+		if err != nil {
+			return "", "", fmt.Errorf("selecting captive portal: %w", err)
+		}
+		target = portal.URL.String()
+	case *TCP:
+		v4, v6, err := randomDNSServers()
+		if err != nil {
+			return "", "", fmt.Errorf("selecting TCP server: %w", err)
+		}
+		return net.JoinHostPort(v4, "53"), net.JoinHostPort(v6, "53"), nil
+	case *ICMP:
+		v4, v6, err := randomDNSServers()
+		if err != nil {
+			return "", "", fmt.Errorf("selecting DNS server: %w", err)
+		}
+		return v4, v6, nil
+	case *Trace:
+		return p.randomTargets()
+	case *DNS:
+		target, err = RandomDomain()
+		if err != nil {
+			return "", "", fmt.Errorf("selecting domain: %w", err)
+		}
+	case *TLS:
+		target, err = RandomTLSServer()
+		if err != nil {
+			return "", "", fmt.Errorf("selecting TLS server: %w", err)
+		}
+	case *UDP:
+		target, err = RandomSTUNServer()
+		if err != nil {
+			return "", "", fmt.Errorf("selecting STUN server: %w", err)
+		}
+	case *NTP:
+		target, err = RandomNTPServer()
+		if err != nil {
+			return "", "", fmt.Errorf("selecting NTP server: %w", err)
+		}
+	case *HTTP3:
+		target, err = RandomHTTP3Server()
+		if err != nil {
+			return "", "", fmt.Errorf("selecting HTTP/3 server: %w", err)
+		}
+	}
+	return target, target, nil
+}
@@ -0,0 +1,158 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Protocol for testing which takes the given time, failing if there is an
+// error.
+type testFamilyProtocol struct {
+	delay time.Duration
+	err   error
+}
+
+func (p *testFamilyProtocol) String() string { return "test-family" }
+
+func (p *testFamilyProtocol) Probe(
+	ctx context.Context, target string,
+) (*Result, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(p.delay):
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &Result{Target: testHostPort}, nil
+}
+
+func TestFamilyNetwork(t *testing.T) {
+	for f, want := range map[Family]string{
+		FamilyAny:  "tcp",
+		FamilyIPv4: "tcp4",
+		FamilyIPv6: "tcp6",
+		FamilyBoth: "tcp",
+	} {
+		got := f.network("tcp")
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestDualStackProbe(t *testing.T) {
+	errTest := errors.New("test error")
+	t.Run("prefers IPv6 if it is not much slower", func(t *testing.T) {
+		proto := &DualStack{
+			IPv4: &testFamilyProtocol{},
+			IPv6: &testFamilyProtocol{delay: 10 * time.Millisecond},
+		}
+		res, err := proto.Probe(context.Background(), testHostPort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Target != testHostPort {
+			t.Fatalf("got %q, want %q", res.Target, testHostPort)
+		}
+		dual := res.DualStack
+		if dual.Preferred != FamilyIPv6 {
+			t.Fatalf("got %q, want %q", dual.Preferred, FamilyIPv6)
+		}
+		if dual.IPv6.RTT < 10*time.Millisecond {
+			t.Fatalf("got %s, want >= %s", dual.IPv6.RTT, 10*time.Millisecond)
+		}
+		if dual.IPv4.Result == nil || dual.IPv6.Result == nil {
+			t.Fatal("got a nil result, want both")
+		}
+	})
+	t.Run("prefers IPv4 if IPv6 is much slower", func(t *testing.T) {
+		proto := &DualStack{
+			IPv4: &testFamilyProtocol{},
+			IPv6: &testFamilyProtocol{delay: happyEyeballsDelay + 50*time.Millisecond},
+		}
+		res, err := proto.Probe(context.Background(), testHostPort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.DualStack.Preferred != FamilyIPv4 {
+			t.Fatalf("got %q, want %q", res.DualStack.Preferred, FamilyIPv4)
+		}
+	})
+	t.Run(
+		"returns the result and an error if a family fails",
+		func(t *testing.T) {
+			proto := &DualStack{
+				IPv4: &testFamilyProtocol{},
+				IPv6: &testFamilyProtocol{err: errTest},
+			}
+			res, err := proto.Probe(context.Background(), testHostPort)
+			if !errors.Is(err, ErrFamily) {
+				t.Fatalf("got %v, want %v", err, ErrFamily)
+			}
+			want := "address family not working: IPv6: test error"
+			if err.Error() != want {
+				t.Fatalf("got %q, want %q", err, want)
+			}
+			if res.DualStack.Preferred != FamilyIPv4 {
+				t.Fatalf("got %q, want %q", res.DualStack.Preferred, FamilyIPv4)
+			}
+			if res.DualStack.IPv6.Error != "test error" {
+				t.Fatalf("got %q, want %q", res.DualStack.IPv6.Error, "test error")
+			}
+			summary := res.Summary()
+			if summary != "ipv4="+res.DualStack.IPv4.RTT.String()+
+				" ipv6=error preferred=ipv4" {
+				t.Fatalf("got %q, want the RTT of IPv4 only", summary)
+			}
+		},
+	)
+	t.Run("returns an error if both families fail", func(t *testing.T) {
+		proto := &DualStack{
+			IPv4: &testFamilyProtocol{err: errTest},
+			IPv6: &testFamilyProtocol{err: errTest},
+		}
+		res, err := proto.Probe(context.Background(), testHostPort)
+		want := "IPv4: test error, IPv6: test error"
+		if err == nil || err.Error() != want {
+			t.Fatalf("got %v, want %q", err, want)
+		}
+		if res != nil {
+			t.Fatalf("got %v should be nil", res)
+		}
+	})
+	t.Run("probes the same server over both families", func(t *testing.T) {
+		v4, v6, err := dualStackTargets(&TCP{Family: FamilyIPv4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		host4, _, _ := net.SplitHostPort(v4)
+		host6, _, _ := net.SplitHostPort(v6)
+		i := slices.IndexFunc(Resolvers, func(ip *net.IP) bool {
+			return ip.String() == host4
+		})
+		if i < 0 || ResolversIPv6[i].String() != host6 {
+			t.Fatalf("got %q and %q, want the same provider", v4, v6)
+		}
+		v4, v6, err = dualStackTargets(&HTTP{Family: FamilyIPv4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v4 == "" || v4 != v6 {
+			t.Fatalf("got %q and %q, want the same URL", v4, v6)
+		}
+	})
+	t.Run("aborts the attempts if the context is cancelled", func(t *testing.T) {
+		proto := &DualStack{
+			IPv4: &testFamilyProtocol{delay: time.Minute},
+			IPv6: &testFamilyProtocol{delay: time.Minute},
+		}
+		_, err := proto.Probe(cancelSoon(t), testHostPort)
+		assertCancelled(t, err)
+	})
+}
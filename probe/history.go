@@ -0,0 +1,205 @@
+package probe
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Defaults of the history rotation.
+const (
+	historyMaxSize  = 10 << 20
+	historyMaxFiles = 3
+)
+
+// HistoryRecord is a report stored in the history.
+type HistoryRecord struct {
+	// When the report was stored.
+	At time.Time `json:"at"`
+	Report
+}
+
+// HistoryQuery selects the records of the history. Empty fields match all.
+type HistoryQuery struct {
+	ProtocolID string
+	// "random" selects the public servers chosen by the protocols.
+	Target string
+	// Records stored at or after this time.
+	Since time.Time
+	// Records stored before this time.
+	Until time.Time
+}
+
+// Returns true if the record is selected by the query.
+func (q *HistoryQuery) matches(r *HistoryRecord) bool {
+	return (q.ProtocolID == "" || r.ProtocolID == q.ProtocolID) &&
+		(q.Target == "" || r.Target == q.Target ||
+			r.groupTarget() == q.Target) &&
+		(q.Since.IsZero() || !r.At.Before(q.Since)) &&
+		(q.Until.IsZero() || r.At.Before(q.Until))
+}
+
+// History stores the reports in a local file, in JSON lines format.
+//
+// The file is rotated when it grows, renaming it with a numeric suffix
+// ('history.jsonl.1' is the most recent) and deleting the oldest ones.
+// It is not safe for concurrent use.
+type History struct {
+	// Path of the current file.
+	Path string
+	// Optional. Size in bytes to rotate the file. 10 MiB by default.
+	MaxSize int64
+	// Optional. Rotated files to keep. 3 by default.
+	MaxFiles int
+	// Optional. Returns the current time, time.Now by default.
+	Now  func() time.Time
+	file *os.File
+	size int64
+}
+
+// Add appends a report to the history.
+func (h *History) Add(r *Report) error {
+	now := time.Now
+	if h.Now != nil {
+		now = h.Now
+	}
+	line, err := json.Marshal(HistoryRecord{At: now(), Report: *r})
+	if err != nil {
+		return fmt.Errorf("marshaling record: %w", err)
+	}
+	line = append(line, '\n')
+	maxSize := h.MaxSize
+	if maxSize == 0 {
+		maxSize = historyMaxSize
+	}
+	// The size of an existing file is known once it is open.
+	if h.file == nil {
+		err = h.open()
+		if err != nil {
+			return fmt.Errorf("opening history: %w", err)
+		}
+	}
+	if h.size > 0 && h.size+int64(len(line)) > maxSize {
+		err = h.rotate()
+		if err != nil {
+			return fmt.Errorf("rotating history: %w", err)
+		}
+		err = h.open()
+		if err != nil {
+			return fmt.Errorf("opening history: %w", err)
+		}
+	}
+	n, err := h.file.Write(line)
+	h.size += int64(n)
+	return err
+}
+
+// Close closes the current file.
+func (h *History) Close() error {
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
+
+// Query returns the records selected, from the oldest to the newest.
+//
+// Malformed lines, as the one written during a crash, are ignored.
+func (h *History) Query(q HistoryQuery) ([]HistoryRecord, error) {
+	var records []HistoryRecord
+	for _, path := range h.files() {
+		file, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("opening history: %w", err)
+		}
+		// Lines include the results, which can be long, so there is no limit.
+		reader := bufio.NewReader(file)
+		for {
+			line, err := reader.ReadBytes('\n')
+			var r HistoryRecord
+			if json.Unmarshal(line, &r) == nil && q.matches(&r) {
+				records = append(records, r)
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				file.Close()
+				return nil, fmt.Errorf("reading history: %w", err)
+			}
+		}
+		file.Close()
+	}
+	return records, nil
+}
+
+// Returns the paths of the files, from the oldest to the current one.
+func (h *History) files() []string {
+	paths := []string{h.Path}
+	for i := 1; i <= h.maxFiles(); i++ {
+		paths = append([]string{h.rotated(i)}, paths...)
+	}
+	return paths
+}
+
+// Opens the current file, creating it if needed.
+func (h *History) open() error {
+	err := os.MkdirAll(filepath.Dir(h.Path), 0o755)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(h.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	h.file, h.size = file, info.Size()
+	return nil
+}
+
+// Moves the current file to the first rotated one, shifting the rest.
+func (h *History) rotate() error {
+	err := h.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Remove(h.rotated(h.maxFiles()))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for i := h.maxFiles() - 1; i >= 1; i-- {
+		err = os.Rename(h.rotated(i), h.rotated(i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	h.size = 0
+	return os.Rename(h.Path, h.rotated(1))
+}
+
+// Returns the path of a rotated file. Example: 'history.jsonl.1'.
+func (h *History) rotated(i int) string {
+	return fmt.Sprintf("%s.%d", h.Path, i)
+}
+
+func (h *History) maxFiles() int {
+	if h.MaxFiles == 0 {
+		return historyMaxFiles
+	}
+	return h.MaxFiles
+}
@@ -0,0 +1,196 @@
+package probe
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a history in a temporary directory which advances the clock a
+// minute for each report.
+func newTestHistory(t *testing.T, start time.Time) *History {
+	t.Helper()
+	now := start
+	h := &History{
+		Path: filepath.Join(t.TempDir(), "up", "history.jsonl"),
+		Now: func() time.Time {
+			now = now.Add(time.Minute)
+			return now
+		},
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestHistory(t *testing.T) {
+	start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	reports := []*Report{
+		{ProtocolID: "tcp", Target: "1.1.1.1:53", Time: 10},
+		{ProtocolID: "dns", Target: "example.com", Error: "timeout"},
+		{ProtocolID: "tcp", Target: "1.1.1.1:53", Time: 20},
+	}
+	t.Run("returns the reports stored", func(t *testing.T) {
+		h := newTestHistory(t, start)
+		for _, r := range reports {
+			err := h.Add(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := h.Query(HistoryQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(reports) {
+			t.Fatalf("got %d records, want %d", len(got), len(reports))
+		}
+		for i, r := range got {
+			if r.Report != *reports[i] {
+				t.Fatalf("%d: got %+v, want %+v", i, r.Report, *reports[i])
+			}
+			want := start.Add(time.Duration(i+1) * time.Minute)
+			if !r.At.Equal(want) {
+				t.Fatalf("%d: got %s, want %s", i, r.At, want)
+			}
+		}
+	})
+	t.Run("returns the reports selected", func(t *testing.T) {
+		h := newTestHistory(t, start)
+		for _, r := range reports {
+			err := h.Add(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, tt := range []struct {
+			name  string
+			query HistoryQuery
+			want  int
+		}{
+			{"protocol", HistoryQuery{ProtocolID: "tcp"}, 2},
+			{"target", HistoryQuery{Target: "example.com"}, 1},
+			{"since", HistoryQuery{Since: start.Add(2 * time.Minute)}, 2},
+			{"until", HistoryQuery{Until: start.Add(2 * time.Minute)}, 1},
+		} {
+			got, err := h.Query(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.want {
+				t.Fatalf("%s: got %d records, want %d", tt.name, len(got), tt.want)
+			}
+		}
+	})
+	t.Run("rotates the file when it grows", func(t *testing.T) {
+		h := newTestHistory(t, start)
+		h.MaxSize = 1
+		h.MaxFiles = 1
+		for _, r := range reports {
+			err := h.Add(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := h.Query(HistoryQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The first one is in the deleted file.
+		if len(got) != 2 || got[0].ProtocolID != "dns" {
+			t.Fatalf("got %+v, want the last 2 records", got)
+		}
+		_, err = os.Stat(h.Path + ".2")
+		if !os.IsNotExist(err) {
+			t.Fatalf("got %v, want the oldest file deleted", err)
+		}
+	})
+	t.Run("rotates the existing file after a restart", func(t *testing.T) {
+		h := newTestHistory(t, start)
+		err := h.Add(reports[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Close()
+		restarted := &History{Path: h.Path, MaxSize: 1}
+		defer restarted.Close()
+		err = restarted.Add(reports[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		rotated, err := os.ReadFile(h.Path + ".1")
+		if err != nil {
+			t.Fatalf("got %v, want the file rotated", err)
+		}
+		current, err := os.ReadFile(h.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rotated) == 0 || len(current) == 0 {
+			t.Fatalf("got %q and %q, want a record in each file", rotated, current)
+		}
+	})
+	t.Run("ignores the malformed lines", func(t *testing.T) {
+		h := newTestHistory(t, start)
+		err := h.Add(reports[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Close()
+		f, err := os.OpenFile(h.Path, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.WriteString(`{"at":"2024-01`)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := h.Query(HistoryQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 {
+			t.Fatalf("got %d records, want 1", len(got))
+		}
+	})
+	t.Run("ignores the oversized lines", func(t *testing.T) {
+		h := newTestHistory(t, start)
+		err := os.MkdirAll(filepath.Dir(h.Path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(h.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.WriteString(strings.Repeat("x", 2<<20) + "\n")
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = h.Add(reports[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Close()
+		got, err := h.Query(HistoryQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 {
+			t.Fatalf("got %d records, want 1", len(got))
+		}
+	})
+	t.Run("returns nothing if the file does not exist", func(t *testing.T) {
+		h := newTestHistory(t, start)
+		got, err := h.Query(HistoryQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 0 {
+			t.Fatalf("got %d records, want 0", len(got))
+		}
+	})
+}
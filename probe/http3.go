@@ -0,0 +1,264 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// ErrFallback is returned when HTTP/3 does not work but HTTPS over TCP does,
+// so the browsers fall back to it. Usually because UDP is blocked.
+var ErrFallback = errors.New("HTTP/3 not working, falling back to TCP")
+
+// HTTP3 protocol implementation.
+//
+// Browsers try HTTP/3 over QUIC (UDP) and silently fall back to HTTPS over TCP
+// if it fails, so both are attempted at the same time to tell the cases apart.
+// Proxies are not used, as they do not carry QUIC.
+type HTTP3 struct {
+	Timeout time.Duration
+	// Optional. IP address family to use. Any by default.
+	Family Family
+	// Optional. Local end of the connections. The system chooses it by
+	// default.
+	Bind Bind
+	// Optional. Certificate authorities to trust. The system ones by default.
+	RootCAs *x509.CertPool
+	// Resolves the host, net.DefaultResolver by default. For testing.
+	lookupIP func(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// String returns the identifier of the protocol.
+func (h *HTTP3) String() string {
+	return "http3"
+}
+
+// Probe makes an HTTP/3 request to a random well-known server.
+//
+// The target is an HTTPS URL.
+// The result includes the status, the size of the response, the negotiated
+// QUIC version and the duration of the QUIC handshake. If only the request
+// over TCP works, its result is returned flagged as a fallback, with an error
+// wrapping ErrFallback.
+func (h *HTTP3) Probe(ctx context.Context, target string) (*Result, error) {
+	rawURL := target
+	if rawURL == "" {
+		var err error
+		rawURL, err = RandomHTTP3Server()
+		if err != nil {
+			return nil, fmt.Errorf("selecting HTTP/3 server: %w", err)
+		}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing target: %w", err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf(
+			"unsupported scheme, HTTPS is required: %s", rawURL,
+		)
+	}
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+	// Only needed if QUIC fails.
+	tcpCtx, cancelTCP := context.WithCancel(ctx)
+	defer cancelTCP()
+	type outcome struct {
+		res *HTTP3Result
+		err error
+	}
+	tcpCh := make(chan outcome, 1)
+	go func() {
+		res, err := h.getTCP(tcpCtx, rawURL)
+		tcpCh <- outcome{res, err}
+	}()
+	res, err := h.getQUIC(ctx, u)
+	if err == nil {
+		return &Result{Target: rawURL, HTTP3: res}, nil
+	}
+	if ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, ctx.Err()
+	}
+	tcp := <-tcpCh
+	if tcp.err != nil {
+		return nil, fmt.Errorf("%w, and over TCP: %w", err, tcp.err)
+	}
+	tcp.res.Fallback = true
+	return &Result{Target: rawURL, HTTP3: tcp.res}, fmt.Errorf(
+		"%w: %w", ErrFallback, err,
+	)
+}
+
+// Makes the request over QUIC, measuring the handshake.
+//
+// The addresses of the host are raced as Happy Eyeballs (RFC 8305) does:
+// each one is tried if the previous fails or does not connect in a while, so
+// an address without route (ie: IPv6) does not hide a working one.
+func (h *HTTP3) getQUIC(ctx context.Context, u *url.URL) (*HTTP3Result, error) {
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	lookup := h.lookupIP
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupIP
+	}
+	ips, err := lookup(ctx, h.Family.network("ip"), u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses for host: %s", u.Hostname())
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("parsing port: %w", err)
+	}
+	dialCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	dials := make(chan *quicDial, len(ips))
+	next, pending := 0, 0
+	// Closes the connections of the attempts which lost the race.
+	defer func() {
+		losers := pending
+		go func() {
+			for range losers {
+				if d := <-dials; d.err == nil {
+					d.close()
+				}
+			}
+		}()
+	}()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var firstErr error
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			if next == len(ips) {
+				continue
+			}
+			addr := &net.UDPAddr{IP: ips[next], Port: portNum}
+			go func() { dials <- h.dialQUIC(dialCtx, u.Hostname(), addr) }()
+			next++
+			pending++
+			timer.Reset(happyEyeballsDelay)
+		case d := <-dials:
+			pending--
+			if d.err == nil {
+				defer d.close()
+				tr := &http3.Transport{}
+				res, err := httpGet(ctx, tr.NewClientConn(d.conn), u.String())
+				if err != nil {
+					return nil, ctxErr(ctx, err)
+				}
+				res.QUICVersion = d.conn.ConnectionState().Version.String()
+				res.Handshake = d.handshake
+				return res, nil
+			}
+			if firstErr == nil {
+				firstErr = d.err
+			}
+			if next < len(ips) {
+				timer.Reset(0)
+			} else if pending == 0 {
+				return nil, fmt.Errorf(
+					"QUIC handshake: %w", ctxErr(ctx, firstErr),
+				)
+			}
+		}
+	}
+}
+
+// QUIC connection to an address, or the reason it failed.
+type quicDial struct {
+	pconn     net.PacketConn
+	conn      *quic.Conn
+	handshake time.Duration
+	err       error
+}
+
+// Connects to the address over QUIC, measuring the handshake.
+func (h *HTTP3) dialQUIC(
+	ctx context.Context, host string, addr *net.UDPAddr,
+) *quicDial {
+	family := FamilyIPv6
+	if addr.IP.To4() != nil {
+		family = FamilyIPv4
+	}
+	pconn, err := h.Bind.listenPacket(ctx, family)
+	if err != nil {
+		return &quicDial{err: err}
+	}
+	start := time.Now()
+	conn, err := quic.Dial(ctx, pconn, addr, &tls.Config{
+		ServerName: host,
+		RootCAs:    h.RootCAs,
+		NextProtos: []string{http3.NextProtoH3},
+	}, &quic.Config{})
+	if err != nil {
+		pconn.Close()
+		return &quicDial{err: err}
+	}
+	return &quicDial{
+		pconn: pconn, conn: conn, handshake: time.Since(start),
+	}
+}
+
+// Closes the connection and its socket.
+func (d *quicDial) close() {
+	d.conn.CloseWithError(0, "")
+	d.pconn.Close()
+}
+
+// Makes the request over TCP, as the browsers do when QUIC fails.
+func (h *HTTP3) getTCP(ctx context.Context, url string) (*HTTP3Result, error) {
+	tr := &http.Transport{
+		DialContext:       h.Bind.dialContext(h.Family),
+		TLSClientConfig:   &tls.Config{RootCAs: h.RootCAs},
+		ForceAttemptHTTP2: true,
+	}
+	defer tr.CloseIdleConnections()
+	return httpGet(ctx, tr, url)
+}
+
+// Makes a GET request, reading the whole response.
+func httpGet(
+	ctx context.Context, rt http.RoundTripper, url string,
+) (*HTTP3Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	return &HTTP3Result{
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		BytesRead:  n,
+	}, nil
+}
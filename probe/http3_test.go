@@ -0,0 +1,158 @@
+package probe
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Creates an HTTPS server for testing, also serving HTTP/3 on the same port if
+// QUIC is enabled. Returns its URL and the authorities to trust.
+func newTestHTTP3Server(
+	t *testing.T, quic bool,
+) (string, *x509.CertPool) {
+	t.Helper()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "pong\n")
+	})
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	// The failed handshakes are expected.
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	if !quic {
+		return server.URL, roots
+	}
+	conn, err := net.ListenPacket("udp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("starting HTTP/3 server: %v", err)
+	}
+	h3 := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(server.TLS.Clone()),
+	}
+	go h3.Serve(conn)
+	t.Cleanup(func() {
+		h3.Close()
+		conn.Close()
+	})
+	return server.URL, roots
+}
+
+func TestHTTP3Probe(t *testing.T) {
+	tout := 1 * time.Second
+	t.Run("returns the HTTP/3 response", func(t *testing.T) {
+		target, roots := newTestHTTP3Server(t, true)
+		proto := &HTTP3{Timeout: tout, RootCAs: roots}
+		got, err := proto.Probe(context.Background(), target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := got.HTTP3
+		if res.StatusCode != http.StatusOK || res.Proto != "HTTP/3.0" ||
+			res.BytesRead != 5 {
+			t.Fatalf("got %+v, want 200 over HTTP/3", res)
+		}
+		if res.QUICVersion != "v1" || res.Handshake <= 0 || res.Fallback {
+			t.Fatalf("got %+v, want the QUIC handshake details", res)
+		}
+	})
+	t.Run("tries the other addresses of the host", func(t *testing.T) {
+		target, roots := newTestHTTP3Server(t, true)
+		proto := &HTTP3{
+			Timeout: tout,
+			RootCAs: roots,
+			// As an IPv6 address without route.
+			lookupIP: func(context.Context, string, string) ([]net.IP, error) {
+				return []net.IP{net.IPv6loopback, net.IPv4(127, 0, 0, 1)}, nil
+			},
+		}
+		got, err := proto.Probe(context.Background(), target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.HTTP3.Proto != "HTTP/3.0" || got.HTTP3.Fallback {
+			t.Fatalf("got %+v, want a response over HTTP/3", got.HTTP3)
+		}
+	})
+	t.Run("falls back to TCP if the host has no addresses", func(t *testing.T) {
+		target, roots := newTestHTTP3Server(t, true)
+		proto := &HTTP3{
+			Timeout: tout,
+			RootCAs: roots,
+			lookupIP: func(context.Context, string, string) ([]net.IP, error) {
+				return nil, nil
+			},
+		}
+		got, err := proto.Probe(context.Background(), target)
+		if !errors.Is(err, ErrFallback) {
+			t.Fatalf("got %v, want %v", err, ErrFallback)
+		}
+		if got == nil || !got.HTTP3.Fallback {
+			t.Fatalf("got %+v, want the response over TCP", got)
+		}
+	})
+	t.Run("flags the fallback to TCP if QUIC does not work",
+		func(t *testing.T) {
+			target, roots := newTestHTTP3Server(t, false)
+			// The QUIC handshake waits until the timeout.
+			proto := &HTTP3{Timeout: tout / 4, RootCAs: roots}
+			got, err := proto.Probe(context.Background(), target)
+			if !errors.Is(err, ErrFallback) {
+				t.Fatalf("got %v, want %v", err, ErrFallback)
+			}
+			if got == nil || !got.HTTP3.Fallback ||
+				got.HTTP3.Proto != "HTTP/2.0" {
+				t.Fatalf("got %+v, want the response over TCP", got)
+			}
+		},
+	)
+	t.Run("returns an error if the certificate is not trusted",
+		func(t *testing.T) {
+			target, _ := newTestHTTP3Server(t, true)
+			proto := &HTTP3{Timeout: tout}
+			_, err := proto.Probe(context.Background(), target)
+			if err == nil || errors.Is(err, ErrFallback) {
+				t.Fatalf("got %v, want a certificate error", err)
+			}
+		},
+	)
+	t.Run("returns an error if the scheme is not HTTPS", func(t *testing.T) {
+		proto := &HTTP3{Timeout: tout}
+		_, err := proto.Probe(context.Background(), "http://127.0.0.1/")
+		if err == nil || !strings.HasPrefix(err.Error(), "unsupported scheme") {
+			t.Fatalf("got %v, want an unsupported scheme error", err)
+		}
+	})
+	t.Run("aborts the attempt if the context is cancelled", func(t *testing.T) {
+		addr := newTestUDPServer(t, func([]byte) [][]byte { return nil })
+		proto := &HTTP3{Timeout: time.Minute}
+		_, err := proto.Probe(cancelSoon(t), "https://"+addr+"/")
+		assertCancelled(t, err)
+	})
+}
+
+func TestRandomHTTP3Server(t *testing.T) {
+	got, err := RandomHTTP3Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(got)
+	if err != nil || u.Scheme != "https" {
+		t.Fatalf("invalid URL: %s", got)
+	}
+}
@@ -0,0 +1,203 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Protocol numbers of ICMP for IPv4 and IPv6.
+const (
+	protocolICMP   = 1
+	protocolICMPv6 = 58
+)
+
+// Payload of the echo requests.
+var icmpPayload = []byte("up")
+
+// ICMP protocol implementation.
+//
+// It uses unprivileged datagram sockets if the system allows it (Linux
+// 'net.ipv4.ping_group_range'), falling back to raw sockets otherwise.
+type ICMP struct {
+	Timeout time.Duration
+	// Optional. IP address family to use. IPv4 by default.
+	Family Family
+	// Sequence number of the last echo request sent.
+	seq atomic.Uint32
+}
+
+// String returns the identifier of the protocol.
+func (i *ICMP) String() string {
+	return "icmp"
+}
+
+// Probe sends an echo request (ping) to a random public DNS server.
+//
+// The target is an IP address or host name. ICMPv6 is used if the family is
+// IPv6.
+// The result includes the sequence number and the TTL of the echo reply.
+func (i *ICMP) Probe(ctx context.Context, target string) (*Result, error) {
+	host := target
+	if host == "" {
+		var err error
+		host, err = randomDNSServer(i.Family)
+		if err != nil {
+			return nil, fmt.Errorf("selecting DNS server: %w", err)
+		}
+	}
+	if i.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.Timeout)
+		defer cancel()
+	}
+	v6 := i.Family == FamilyIPv6
+	network := "ip4"
+	if v6 {
+		network = "ip6"
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+	// IP addresses are not resolved, so the context could be already done.
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	conn, privileged, err := listenICMP(i.Family)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop, err := closeOnDone(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	// The kernel overwrites the identifier of unprivileged sockets.
+	id := os.Getpid() & 0xffff
+	seq := int(i.seq.Add(1) & 0xffff)
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	proto := protocolICMP
+	if v6 {
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		proto = protocolICMPv6
+	}
+	req := icmp.Message{
+		Type: echoType,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: icmpPayload},
+	}
+	wb, err := req.Marshal(nil)
+	if err != nil {
+		return nil, fmt.Errorf("encoding echo request: %w", err)
+	}
+	var dst net.Addr = &net.IPAddr{IP: ips[0]}
+	if !privileged {
+		dst = &net.UDPAddr{IP: ips[0]}
+	}
+	_, err = conn.WriteTo(wb, dst)
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	var read icmpReader
+	if v6 {
+		read = readICMPv6(conn)
+	} else {
+		read = readICMPv4(conn)
+	}
+	rb := make([]byte, 1500)
+	for {
+		n, ttl, peer, err := read(rb)
+		if err != nil {
+			return nil, ctxErr(ctx, err)
+		}
+		reply, err := icmp.ParseMessage(proto, rb[:n])
+		if err != nil {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		if reply.Type != replyType || !ok || echo.Seq != seq {
+			continue
+		}
+		if privileged && echo.ID != id {
+			continue
+		}
+		res := &ICMPResult{Addr: ips[0].String(), Seq: seq, TTL: ttl, Size: n}
+		if peer != nil {
+			res.Addr = addrIP(peer)
+		}
+		return &Result{Target: host, ICMP: res}, nil
+	}
+}
+
+// Reads a packet, returning its size, TTL, and sender.
+type icmpReader func(b []byte) (int, int, net.Addr, error)
+
+// Returns a reader of ICMP for IPv4 packets.
+func readICMPv4(conn *icmp.PacketConn) icmpReader {
+	pc := conn.IPv4PacketConn()
+	// Not supported by all platforms, the TTL is zero in that case.
+	_ = pc.SetControlMessage(ipv4.FlagTTL, true)
+	return func(b []byte) (int, int, net.Addr, error) {
+		n, cm, peer, err := pc.ReadFrom(b)
+		if cm == nil {
+			return n, 0, peer, err
+		}
+		return n, cm.TTL, peer, err
+	}
+}
+
+// Returns a reader of ICMP for IPv6 packets, using the hop limit as TTL.
+func readICMPv6(conn *icmp.PacketConn) icmpReader {
+	pc := conn.IPv6PacketConn()
+	_ = pc.SetControlMessage(ipv6.FlagHopLimit, true)
+	return func(b []byte) (int, int, net.Addr, error) {
+		n, cm, peer, err := pc.ReadFrom(b)
+		if cm == nil {
+			return n, 0, peer, err
+		}
+		return n, cm.HopLimit, peer, err
+	}
+}
+
+// Opens an ICMP socket of the family (IPv4 if any), an unprivileged one if
+// possible.
+//
+// Returns true if the socket is a raw one.
+func listenICMP(f Family) (*icmp.PacketConn, bool, error) {
+	network, rawNetwork, addr := "udp4", "ip4:icmp", "0.0.0.0"
+	if f == FamilyIPv6 {
+		network, rawNetwork, addr = "udp6", "ip6:ipv6-icmp", "::"
+	}
+	conn, err := icmp.ListenPacket(network, addr)
+	if err == nil {
+		return conn, false, nil
+	}
+	conn, rawErr := icmp.ListenPacket(rawNetwork, addr)
+	if rawErr != nil {
+		return nil, false, fmt.Errorf(
+			"opening ICMP socket: %w", errors.Join(err, rawErr),
+		)
+	}
+	return conn, true, nil
+}
+
+// Returns the IP address of a network address.
+func addrIP(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.String()
+	case *net.IPAddr:
+		return a.IP.String()
+	default:
+		return addr.String()
+	}
+}
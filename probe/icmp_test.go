@@ -0,0 +1,67 @@
+package probe
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestICMPProbe(t *testing.T) {
+	tout := 1 * time.Second
+	conn, _, err := listenICMP(FamilyIPv4)
+	if err != nil {
+		t.Skipf("ICMP sockets not allowed: %v", err)
+	}
+	conn.Close()
+	t.Run("returns the echo reply details if successful", func(t *testing.T) {
+		proto := &ICMP{Timeout: tout}
+		res, err := proto.Probe(context.Background(), "127.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Target != "127.0.0.1" {
+			t.Fatalf("got %q, want %q", res.Target, "127.0.0.1")
+		}
+		if res.ICMP.Addr != "127.0.0.1" {
+			t.Fatalf("got %q, want %q", res.ICMP.Addr, "127.0.0.1")
+		}
+		if res.ICMP.Seq != 1 {
+			t.Fatalf("got %d, want %d", res.ICMP.Seq, 1)
+		}
+		if res.ICMP.TTL == 0 {
+			t.Fatalf("got %d, want > 0", res.ICMP.TTL)
+		}
+		res, err = proto.Probe(context.Background(), "127.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.ICMP.Seq != 2 {
+			t.Fatalf("got %d, want %d", res.ICMP.Seq, 2)
+		}
+	})
+	t.Run("uses ICMPv6 for IPv6", func(t *testing.T) {
+		conn, _, err := listenICMP(FamilyIPv6)
+		if err != nil {
+			t.Skipf("ICMPv6 sockets not allowed: %v", err)
+		}
+		conn.Close()
+		proto := &ICMP{Timeout: tout, Family: FamilyIPv6}
+		res, err := proto.Probe(context.Background(), "::1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.ICMP.Addr != "::1" {
+			t.Fatalf("got %q, want %q", res.ICMP.Addr, "::1")
+		}
+		if res.ICMP.TTL == 0 {
+			t.Fatalf("got %d, want > 0", res.ICMP.TTL)
+		}
+	})
+	t.Run("aborts the attempt if the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		proto := &ICMP{Timeout: tout}
+		_, err := proto.Probe(ctx, "127.0.0.1")
+		assertCancelled(t, err)
+	})
+}
@@ -0,0 +1,152 @@
+package probe
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Upper bounds (in seconds) of the response time histogram buckets.
+var metricsBuckets = []float64{
+	.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10,
+}
+
+// Metrics aggregates the reports to be exposed in the Prometheus text format.
+//
+// The zero value is ready to use. It is safe for concurrent use.
+type Metrics struct {
+	mu sync.Mutex
+	// Series in order of appearance.
+	series []*metricsSeries
+}
+
+// Metrics of the same check, interface, protocol and target. "random" for the
+// public servers chosen by the protocol.
+type metricsSeries struct {
+	check      string
+	iface      string
+	protocolID string
+	target     string
+	attempts   uint64
+	failures   uint64
+	// Cumulative counts of the response times for each bucket.
+	buckets []uint64
+	// Sum of the response times, in seconds.
+	sum float64
+}
+
+// Add includes a new report in the metrics.
+//
+// The response time is only observed for successful attempts.
+func (m *Metrics) Add(r *Report) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	target := r.groupTarget()
+	var series *metricsSeries
+	for _, s := range m.series {
+		if s.check == r.Check && s.iface == r.Interface &&
+			s.protocolID == r.ProtocolID && s.target == target {
+			series = s
+			break
+		}
+	}
+	if series == nil {
+		series = &metricsSeries{
+			check:      r.Check,
+			iface:      r.Interface,
+			protocolID: r.ProtocolID,
+			target:     target,
+			buckets:    make([]uint64, len(metricsBuckets)),
+		}
+		m.series = append(m.series, series)
+	}
+	series.attempts++
+	if !r.Succeeded() {
+		series.failures++
+		return
+	}
+	secs := r.Time.Seconds()
+	series.sum += secs
+	for i, bound := range metricsBuckets {
+		if secs <= bound {
+			series.buckets[i]++
+		}
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("# HELP up_probe_attempts_total Number of connection attempts.\n")
+	b.WriteString("# TYPE up_probe_attempts_total counter\n")
+	for _, s := range m.series {
+		fmt.Fprintf(&b, "up_probe_attempts_total{%s} %d\n", s.labels(), s.attempts)
+	}
+	b.WriteString("# HELP up_probe_failures_total Number of failed connection attempts.\n")
+	b.WriteString("# TYPE up_probe_failures_total counter\n")
+	for _, s := range m.series {
+		fmt.Fprintf(&b, "up_probe_failures_total{%s} %d\n", s.labels(), s.failures)
+	}
+	b.WriteString("# HELP up_probe_duration_seconds Response time of the successful connection attempts.\n")
+	b.WriteString("# TYPE up_probe_duration_seconds histogram\n")
+	for _, s := range m.series {
+		labels := s.labels()
+		for i, bound := range metricsBuckets {
+			fmt.Fprintf(
+				&b, "up_probe_duration_seconds_bucket{%s,le=%q} %d\n",
+				labels, formatFloat(bound), s.buckets[i],
+			)
+		}
+		count := s.attempts - s.failures
+		fmt.Fprintf(
+			&b, "up_probe_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n",
+			labels, count,
+		)
+		fmt.Fprintf(
+			&b, "up_probe_duration_seconds_sum{%s} %s\n",
+			labels, formatFloat(s.sum),
+		)
+		fmt.Fprintf(&b, "up_probe_duration_seconds_count{%s} %d\n", labels, count)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Returns the labels of the series in the exposition format.
+//
+// The check and interface labels are only included for the reports of a check
+// or through an interface.
+func (s *metricsSeries) labels() string {
+	labels := fmt.Sprintf(
+		"protocol=\"%s\",target=\"%s\"",
+		escapeLabel(s.protocolID), escapeLabel(s.target),
+	)
+	if s.iface != "" {
+		labels = fmt.Sprintf("interface=\"%s\",%s", escapeLabel(s.iface), labels)
+	}
+	if s.check != "" {
+		labels = fmt.Sprintf("check=\"%s\",%s", escapeLabel(s.check), labels)
+	}
+	return labels
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,62 @@
+package probe
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	var m Metrics
+	m.Add(&Report{ProtocolID: "tcp", Target: "127.0.0.1:80", Time: 20 * time.Millisecond})
+	m.Add(&Report{ProtocolID: "tcp", Target: "127.0.0.1:80", Time: 3 * time.Second})
+	m.Add(&Report{ProtocolID: "tcp", Target: "127.0.0.1:80", Error: "error-0"})
+	m.Add(&Report{ProtocolID: "dns", Target: `a"b`, Time: time.Millisecond})
+	m.Add(&Report{ProtocolID: "udp", Target: "1.1.1.1:53", RandomTarget: true})
+	m.Add(&Report{ProtocolID: "udp", RandomTarget: true, Error: "timeout"})
+	server := httptest.NewServer(&m)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(body)
+	t.Run("uses the text exposition format", func(t *testing.T) {
+		ct := resp.Header.Get("Content-Type")
+		if !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+			t.Fatalf("got %q, want the text exposition format", ct)
+		}
+	})
+	for _, want := range []string{
+		"# TYPE up_probe_attempts_total counter\n",
+		`up_probe_attempts_total{protocol="tcp",target="127.0.0.1:80"} 3` + "\n",
+		`up_probe_attempts_total{protocol="dns",target="a\"b"} 1` + "\n",
+		"# TYPE up_probe_failures_total counter\n",
+		`up_probe_failures_total{protocol="tcp",target="127.0.0.1:80"} 1` + "\n",
+		`up_probe_failures_total{protocol="dns",target="a\"b"} 0` + "\n",
+		`up_probe_attempts_total{protocol="udp",target="random"} 2` + "\n",
+		`up_probe_failures_total{protocol="udp",target="random"} 1` + "\n",
+		"# TYPE up_probe_duration_seconds histogram\n",
+		`up_probe_duration_seconds_bucket{protocol="tcp",target="127.0.0.1:80",le="0.01"} 0` + "\n",
+		`up_probe_duration_seconds_bucket{protocol="tcp",target="127.0.0.1:80",le="0.025"} 1` + "\n",
+		`up_probe_duration_seconds_bucket{protocol="tcp",target="127.0.0.1:80",le="2.5"} 1` + "\n",
+		`up_probe_duration_seconds_bucket{protocol="tcp",target="127.0.0.1:80",le="5"} 2` + "\n",
+		`up_probe_duration_seconds_bucket{protocol="tcp",target="127.0.0.1:80",le="+Inf"} 2` + "\n",
+		`up_probe_duration_seconds_sum{protocol="tcp",target="127.0.0.1:80"} 3.02` + "\n",
+		`up_probe_duration_seconds_count{protocol="tcp",target="127.0.0.1:80"} 2` + "\n",
+	} {
+		t.Run("includes "+strings.TrimSpace(want), func(t *testing.T) {
+			if !strings.Contains(got, want) {
+				t.Fatalf("got %q, want it to include %q", got, want)
+			}
+		})
+	}
+}
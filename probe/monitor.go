@@ -0,0 +1,201 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// State is the availability of a monitored protocol and target.
+type State string
+
+const (
+	// The last attempts succeeded.
+	StateUp State = "up"
+	// The last attempts failed.
+	StateDown State = "down"
+)
+
+// Monitor watches the reports to detect when a protocol and target goes up or
+// down, ignoring isolated failures and successes.
+//
+// The zero value is ready to use, changing the state after a single attempt.
+// It is not safe for concurrent use.
+type Monitor struct {
+	// Consecutive failed attempts to consider a target down.
+	DownAfter int
+	// Consecutive successful attempts to consider a target up.
+	UpAfter int
+	// Optional. Returns the current time, time.Now by default.
+	Now func() time.Time
+	// State of each check, protocol and target.
+	states map[monitorKey]*monitorState
+}
+
+// Identifies the reports of the same check, interface, protocol and target.
+type monitorKey struct {
+	check      string
+	iface      string
+	protocolID string
+	target     string
+}
+
+// Attempts of a check, protocol and target.
+type monitorState struct {
+	// Empty until the threshold is reached the first time.
+	state State
+	// Consecutive attempts with the same outcome.
+	streak int
+	// Outcome of the streak.
+	ok bool
+	// When the current streak started.
+	since time.Time
+	// When the last outage started.
+	downSince time.Time
+}
+
+// Transition is a change in the state of a protocol and target.
+type Transition struct {
+	// Name of the check, if any.
+	Check string `json:"check,omitempty"`
+	// Network interface used, if bound to one.
+	Interface string `json:"interface,omitempty"`
+	// Protocol used to connect to.
+	ProtocolID string `json:"protocol"`
+	// Target used to connect to. "random" for the public servers chosen by
+	// the protocol.
+	Target string `json:"target"`
+	// New state.
+	State State `json:"state"`
+	// Previous state, empty for the first transition.
+	From State `json:"from,omitempty"`
+	// When the state changed: the first attempt of the streak which reached
+	// the threshold.
+	Time time.Time `json:"time"`
+	// Duration of the outage, when going up.
+	Outage time.Duration `json:"outage,omitempty"`
+	// Error of the last attempt, when going down.
+	Error string `json:"error,omitempty"`
+	// Last attempt, which caused the transition.
+	Report *Report `json:"report,omitempty"`
+}
+
+// Add includes a new report, returning the transition it causes, if any.
+func (m *Monitor) Add(r *Report) *Transition {
+	now := time.Now
+	if m.Now != nil {
+		now = m.Now
+	}
+	at := now()
+	if m.states == nil {
+		m.states = map[monitorKey]*monitorState{}
+	}
+	target := r.groupTarget()
+	key := monitorKey{r.Check, r.Interface, r.ProtocolID, target}
+	s, ok := m.states[key]
+	if !ok {
+		s = &monitorState{}
+		m.states[key] = s
+	}
+	success := r.Succeeded()
+	if s.streak == 0 || s.ok != success {
+		s.streak = 0
+		s.ok = success
+		s.since = at
+	}
+	s.streak++
+	state, threshold := StateDown, m.DownAfter
+	if success {
+		state, threshold = StateUp, m.UpAfter
+	}
+	if s.state == state || s.streak < max(threshold, 1) {
+		return nil
+	}
+	t := &Transition{
+		Check:      r.Check,
+		Interface:  r.Interface,
+		ProtocolID: r.ProtocolID,
+		Target:     target,
+		State:      state,
+		From:       s.state,
+		Time:       s.since,
+		Report:     r,
+	}
+	if state == StateDown {
+		t.Error = r.Error
+		s.downSince = s.since
+	} else if s.state == StateDown {
+		t.Outage = s.since.Sub(s.downSince)
+	}
+	s.state = state
+	return t
+}
+
+// Identifies the transitions of the same check, interface, protocol and
+// target.
+func (t *Transition) key() monitorKey {
+	return monitorKey{t.Check, t.Interface, t.ProtocolID, t.Target}
+}
+
+// String returns the transition ready to be printed.
+func (t *Transition) String(format Format) (string, error) {
+	switch format {
+	case HumanFormat:
+		return t.stringHuman(), nil
+	case JSONFormat:
+		out, err := json.Marshal(t)
+		if err != nil {
+			return "", fmt.Errorf("marshaling transition: %w", err)
+		}
+		return string(out), nil
+	case GrepFormat:
+		return t.stringGrep(), nil
+	default:
+		return "", fmt.Errorf("unsupported format: %v", format)
+	}
+}
+
+// Returns the transition in human readable format.
+// Example: '2024-01-02T15:04:05Z ▲ up   tcp 1.1.1.1:53 (outage=5m3s)'
+// Going down includes the error. Example:
+// '2024-01-02T15:04:05Z ▼ down tcp 1.1.1.1:53 (i/o timeout)'
+func (t *Transition) stringHuman() string {
+	prefix := green("▲")
+	suffix := ""
+	switch {
+	case t.State == StateDown:
+		prefix = red("▼")
+		suffix = fmt.Sprintf(" (%s)", t.Error)
+	case t.From == StateDown:
+		suffix = fmt.Sprintf(" (outage=%s)", t.Outage)
+	}
+	line := fmt.Sprintf(
+		"%s %s", bold(withInterface(t.ProtocolID, t.Interface)), t.Target,
+	)
+	if t.Check != "" {
+		line = fmt.Sprintf("[%s] %s", t.Check, line)
+	}
+	return fmt.Sprintf(
+		"%s %s %-4s %s%s",
+		t.Time.Format(time.RFC3339), prefix, t.State, line, faint(suffix),
+	)
+}
+
+// Returns the transition in a grepable format.
+//
+// Example: 'transition	2024-01-02T15:04:05Z	up	tcp	1.1.1.1:53	outage=5m3s'
+// Going down includes the error instead. The interface and the check are
+// appended, if any. Example: 'check=portal'.
+func (t *Transition) stringGrep() string {
+	line := fmt.Sprintf(
+		"transition\t%s\t%s\t%s\t%s",
+		t.Time.Format(time.RFC3339), t.State, t.ProtocolID, t.Target,
+	)
+	switch {
+	case t.State == StateDown:
+		line = fmt.Sprintf("%s\t%s", line, t.Error)
+	case t.From == StateDown:
+		line = fmt.Sprintf("%s\toutage=%s", line, t.Outage)
+	}
+	return withLabels(line, t.Interface, t.Check)
+}
@@ -0,0 +1,175 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonitorAdd(t *testing.T) {
+	start := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	ok := &Report{ProtocolID: "tcp", Target: "1.1.1.1:53"}
+	failed := &Report{ProtocolID: "tcp", Target: "1.1.1.1:53", Error: "timeout"}
+	// Returns a monitor which advances the clock a minute for each report.
+	newMonitor := func(downAfter, upAfter int) *Monitor {
+		now := start
+		return &Monitor{
+			DownAfter: downAfter,
+			UpAfter:   upAfter,
+			Now: func() time.Time {
+				now = now.Add(time.Minute)
+				return now
+			},
+		}
+	}
+	t.Run("returns the first state", func(t *testing.T) {
+		m := newMonitor(0, 0)
+		got := m.Add(ok)
+		if got == nil {
+			t.Fatal("got nil, want a transition")
+		}
+		if got.State != StateUp || got.From != "" {
+			t.Fatalf("got %+v, want the first up", got)
+		}
+		if got.ProtocolID != "tcp" || got.Target != "1.1.1.1:53" {
+			t.Fatalf("got %+v, want the protocol and target", got)
+		}
+		if got.Report != ok {
+			t.Fatalf("got %+v, want the report", got.Report)
+		}
+		if got := m.Add(ok); got != nil {
+			t.Fatalf("got %+v, want nil", got)
+		}
+	})
+	t.Run("waits for the consecutive attempts", func(t *testing.T) {
+		m := newMonitor(3, 2)
+		want := []State{"", "", StateDown, "", "", "", StateUp}
+		for i, r := range []*Report{failed, failed, failed, ok, failed, ok, ok} {
+			got := m.Add(r)
+			switch {
+			case want[i] == "" && got != nil:
+				t.Fatalf("%d: got %+v, want nil", i, got)
+			case want[i] != "" && (got == nil || got.State != want[i]):
+				t.Fatalf("%d: got %+v, want %s", i, got, want[i])
+			}
+		}
+	})
+	t.Run("includes the outage when going up", func(t *testing.T) {
+		m := newMonitor(2, 2)
+		m.Add(ok)
+		m.Add(ok)
+		m.Add(failed)
+		down := m.Add(failed)
+		if down.State != StateDown || down.From != StateUp {
+			t.Fatalf("got %+v, want down from up", down)
+		}
+		if down.Error != "timeout" {
+			t.Fatalf("got %q, want %q", down.Error, "timeout")
+		}
+		// The first failure.
+		if !down.Time.Equal(start.Add(3 * time.Minute)) {
+			t.Fatalf("got %s, want %s", down.Time, start.Add(3*time.Minute))
+		}
+		m.Add(failed)
+		m.Add(ok)
+		up := m.Add(ok)
+		if up.State != StateUp || up.From != StateDown {
+			t.Fatalf("got %+v, want up from down", up)
+		}
+		if up.Outage != 3*time.Minute {
+			t.Fatalf("got %s, want %s", up.Outage, 3*time.Minute)
+		}
+	})
+	t.Run("tracks each protocol and target", func(t *testing.T) {
+		m := newMonitor(1, 1)
+		other := &Report{ProtocolID: "dns", Target: "1.1.1.1:53"}
+		if m.Add(ok) == nil || m.Add(other) == nil {
+			t.Fatal("got nil, want a transition for each")
+		}
+		checked := &Report{Check: "a", ProtocolID: "tcp", Target: "1.1.1.1:53"}
+		if m.Add(checked) == nil {
+			t.Fatal("got nil, want a transition for the check")
+		}
+	})
+	t.Run("tracks the random targets together", func(t *testing.T) {
+		m := newMonitor(1, 1)
+		want := []State{StateUp, "", StateDown, StateUp}
+		for i, r := range []*Report{
+			{ProtocolID: "tcp", Target: "1.1.1.1:53", RandomTarget: true},
+			{ProtocolID: "tcp", Target: "8.8.8.8:53", RandomTarget: true},
+			{ProtocolID: "tcp", RandomTarget: true, Error: "timeout"},
+			{ProtocolID: "tcp", Target: "9.9.9.9:53", RandomTarget: true},
+		} {
+			got := m.Add(r)
+			switch {
+			case want[i] == "" && got != nil:
+				t.Fatalf("%d: got %+v, want nil", i, got)
+			case want[i] != "" && (got == nil || got.State != want[i]):
+				t.Fatalf("%d: got %+v, want %s", i, got, want[i])
+			case got != nil && got.Target != "random":
+				t.Fatalf("%d: got %q, want %q", i, got.Target, "random")
+			}
+			if i == 3 && got.Outage != time.Minute {
+				t.Fatalf("got %s, want %s", got.Outage, time.Minute)
+			}
+		}
+	})
+}
+
+func TestTransitionString(t *testing.T) {
+	at := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	up := Transition{
+		ProtocolID: "tcp",
+		Target:     "1.1.1.1:53",
+		State:      StateUp,
+		From:       StateDown,
+		Time:       at,
+		Outage:     5 * time.Minute,
+	}
+	down := Transition{
+		Check:      "dns",
+		ProtocolID: "tcp",
+		Target:     "1.1.1.1:53",
+		State:      StateDown,
+		From:       StateUp,
+		Time:       at,
+		Error:      "timeout",
+	}
+	tests := []struct {
+		name       string
+		transition Transition
+		format     Format
+		want       string
+	}{
+		{
+			"human up", up, HumanFormat,
+			"2024-01-02T15:04:05Z ▲ up   tcp 1.1.1.1:53 (outage=5m0s)",
+		},
+		{
+			"human down", down, HumanFormat,
+			"2024-01-02T15:04:05Z ▼ down [dns] tcp 1.1.1.1:53 (timeout)",
+		},
+		{
+			"grepable up", up, GrepFormat,
+			"transition\t2024-01-02T15:04:05Z\tup\ttcp\t1.1.1.1:53\toutage=5m0s",
+		},
+		{
+			"grepable down", down, GrepFormat,
+			"transition\t2024-01-02T15:04:05Z\tdown\ttcp\t1.1.1.1:53\ttimeout\tcheck=dns",
+		},
+		{
+			"JSON", up, JSONFormat,
+			`{"protocol":"tcp","target":"1.1.1.1:53","state":"up","from":"down","time":"2024-01-02T15:04:05Z","outage":300000000000}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run("returns the "+tt.name+" format", func(t *testing.T) {
+			got, err := tt.transition.String(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Templates of the webhook payloads for well-known services.
+const (
+	// Slack incoming webhooks.
+	SlackTemplate = `{"text":{{json .Message}}}`
+	// Microsoft Teams incoming webhooks.
+	TeamsTemplate = `{"@type":"MessageCard",` +
+		`"@context":"https://schema.org/extensions",` +
+		`"summary":{{json .Message}},"text":{{json .Message}}}`
+)
+
+// ErrRateLimited is returned when a notification is dropped because too many
+// were sent recently.
+var ErrRateLimited = errors.New("too many notifications")
+
+// Notifier is notified about the changes of state, to alert someone.
+type Notifier interface {
+	Notify(ctx context.Context, t *Transition) error
+}
+
+// Message returns a short description of the transition, to be used in the
+// notifications. Example: 'tcp 1.1.1.1:53 is up after a 5m0s outage'.
+func (t *Transition) Message() string {
+	msg := fmt.Sprintf(
+		"%s %s is %s",
+		withInterface(t.ProtocolID, t.Interface), t.Target, t.State,
+	)
+	if t.Check != "" {
+		msg = fmt.Sprintf("[%s] %s", t.Check, msg)
+	}
+	switch {
+	case t.State == StateDown:
+		msg = fmt.Sprintf("%s: %s", msg, t.Error)
+	case t.From == StateDown:
+		msg = fmt.Sprintf("%s after a %s outage", msg, t.Outage)
+	}
+	return msg
+}
+
+// Webhook sends the transitions in HTTP POST requests.
+type Webhook struct {
+	URL string
+	// Optional. Body of the requests, as a text/template executed with the
+	// transition, including the report which caused it. The 'json' function
+	// encodes a value. The transition in JSON format by default. Example:
+	// SlackTemplate.
+	Template string
+	// Optional. The one of the standard library, with a timeout, by default.
+	Client *http.Client
+}
+
+// Notify sends the transition to the URL.
+//
+// Returns an error if the response status is not a successful one.
+func (w *Webhook) Notify(ctx context.Context, t *Transition) error {
+	body, err := w.payload(t)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, w.URL, bytes.NewReader(body),
+	)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	cli := w.Client
+	if cli == nil {
+		cli = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected webhook status: %s", resp.Status)
+	}
+	return nil
+}
+
+// Returns the body of the request.
+func (w *Webhook) payload(t *Transition) ([]byte, error) {
+	if w.Template == "" {
+		body, err := json.Marshal(t)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling transition: %w", err)
+		}
+		return body, nil
+	}
+	tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			out, err := json.Marshal(v)
+			return string(out), err
+		},
+	}).Parse(w.Template)
+	if err != nil {
+		return nil, fmt.Errorf("parsing webhook template: %w", err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, t)
+	if err != nil {
+		return nil, fmt.Errorf("executing webhook template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Command runs a local program for each transition.
+//
+// The transition is written to its standard input in JSON format, including
+// the report which caused it, and set in the environment variables:
+// UP_EVENT_STATE, UP_EVENT_FROM, UP_EVENT_PROTOCOL, UP_EVENT_TARGET,
+// UP_EVENT_CHECK, UP_EVENT_INTERFACE, UP_EVENT_TIME (RFC 3339),
+// UP_EVENT_OUTAGE, UP_EVENT_ERROR and UP_EVENT_MESSAGE. They do not collide
+// with the ones of the flags, in case the program runs 'up'.
+type Command struct {
+	// Path of the program.
+	Name string
+	// Optional. Arguments of the program.
+	Args []string
+}
+
+// Notify runs the program, waiting for it to finish.
+//
+// Returns an error, including its output, if it fails.
+func (c *Command) Notify(ctx context.Context, t *Transition) error {
+	input, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("marshaling transition: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(
+		os.Environ(),
+		"UP_EVENT_STATE="+string(t.State),
+		"UP_EVENT_FROM="+string(t.From),
+		"UP_EVENT_PROTOCOL="+t.ProtocolID,
+		"UP_EVENT_TARGET="+t.Target,
+		"UP_EVENT_CHECK="+t.Check,
+		"UP_EVENT_INTERFACE="+t.Interface,
+		"UP_EVENT_TIME="+t.Time.Format(time.RFC3339),
+		"UP_EVENT_OUTAGE="+t.Outage.String(),
+		"UP_EVENT_ERROR="+t.Error,
+		"UP_EVENT_MESSAGE="+t.Message(),
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf(
+			"running command: %w: %s", err, strings.TrimSpace(string(out)),
+		)
+	}
+	return nil
+}
+
+// Hooks sends the transitions to many notifiers, retrying the failed attempts
+// and limiting their rate, to avoid flooding them if a target is flapping.
+// The recovery of a target notified as down is always sent, not to leave it
+// down.
+//
+// It is safe for concurrent use.
+type Hooks struct {
+	Notifiers []Notifier
+	// Additional attempts after a failure.
+	Retries int
+	// Time to wait before the first retry, doubled for each one.
+	RetryDelay time.Duration
+	// Maximum notifications per minute. Unlimited if zero.
+	RateLimit int
+	// Optional. To log the failures.
+	Logger *slog.Logger
+	mu     sync.Mutex
+	// Times of the notifications in the last minute.
+	sent []time.Time
+	// Targets whose last notification was going down.
+	down map[monitorKey]bool
+}
+
+// Notify sends the transition to all the notifiers.
+//
+// The first one of a target going up is skipped, there is nothing to report
+// at startup, so it does not count against the rate limit.
+// Returns the errors of the notifiers which failed every attempt, or
+// ErrRateLimited if it is dropped.
+func (h *Hooks) Notify(ctx context.Context, t *Transition) error {
+	if t.From == "" && t.State == StateUp {
+		return nil
+	}
+	if !h.allow(time.Now(), t) {
+		return ErrRateLimited
+	}
+	errs := make([]error, len(h.Notifiers))
+	var wg sync.WaitGroup
+	for i, n := range h.Notifiers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = h.notify(ctx, n, t)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Sends the transition to a notifier, retrying if it fails.
+func (h *Hooks) notify(ctx context.Context, n Notifier, t *Transition) error {
+	delay := h.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := n.Notify(ctx, t)
+		if err == nil || attempt >= h.Retries {
+			return err
+		}
+		if h.Logger != nil {
+			h.Logger.Debug(
+				"Notification failed, retrying", "attempt", attempt, "error", err,
+			)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// Returns true if a new notification is under the rate limit or it is the
+// recovery of a target notified as down, recording it.
+func (h *Hooks) allow(now time.Time, t *Transition) bool {
+	if h.RateLimit == 0 {
+		return true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	recent := h.sent[:0]
+	for _, at := range h.sent {
+		if now.Sub(at) < time.Minute {
+			recent = append(recent, at)
+		}
+	}
+	h.sent = recent
+	key := t.key()
+	recovery := t.State == StateUp && h.down[key]
+	if len(h.sent) >= h.RateLimit && !recovery {
+		return false
+	}
+	h.sent = append(h.sent, now)
+	if h.down == nil {
+		h.down = map[monitorKey]bool{}
+	}
+	if t.State == StateDown {
+		h.down[key] = true
+	} else {
+		delete(h.down, key)
+	}
+	return true
+}
@@ -0,0 +1,334 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testTransition = &Transition{
+	ProtocolID: "tcp",
+	Target:     "1.1.1.1:53",
+	State:      StateUp,
+	From:       StateDown,
+	Time:       time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+	Outage:     5 * time.Minute,
+}
+
+// Returns a webhook receiver storing the request bodies, answering with the
+// status codes in order, and 200 once they are consumed.
+func newTestReceiver(t *testing.T, codes ...int) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			defer mu.Unlock()
+			if r.Method != http.MethodPost ||
+				r.Header.Get("Content-Type") != "application/json" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			bodies = append(bodies, string(body))
+			if len(codes) > 0 {
+				w.WriteHeader(codes[0])
+				codes = codes[1:]
+			}
+		},
+	))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+func TestTransitionMessage(t *testing.T) {
+	t.Run("returns the outage when going up", func(t *testing.T) {
+		got := testTransition.Message()
+		want := "tcp 1.1.1.1:53 is up after a 5m0s outage"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("returns the error when going down", func(t *testing.T) {
+		tr := &Transition{
+			Check: "dns", ProtocolID: "tcp", Target: "1.1.1.1:53",
+			State: StateDown, Error: "timeout",
+		}
+		got := tr.Message()
+		want := "[dns] tcp 1.1.1.1:53 is down: timeout"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestWebhookNotify(t *testing.T) {
+	t.Run("posts the transition in JSON format", func(t *testing.T) {
+		srv, bodies := newTestReceiver(t)
+		w := &Webhook{URL: srv.URL}
+		err := w.Notify(context.Background(), testTransition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Transition
+		err = json.Unmarshal([]byte(bodies()[0]), &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != *testTransition {
+			t.Fatalf("got %+v, want %+v", got, *testTransition)
+		}
+	})
+	t.Run("posts the Slack payload", func(t *testing.T) {
+		srv, bodies := newTestReceiver(t)
+		w := &Webhook{URL: srv.URL, Template: SlackTemplate}
+		err := w.Notify(context.Background(), testTransition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := bodies()[0]
+		want := `{"text":"tcp 1.1.1.1:53 is up after a 5m0s outage"}`
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("posts the Teams payload", func(t *testing.T) {
+		srv, bodies := newTestReceiver(t)
+		w := &Webhook{URL: srv.URL, Template: TeamsTemplate}
+		err := w.Notify(context.Background(), testTransition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]string
+		err = json.Unmarshal([]byte(bodies()[0]), &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got["@type"] != "MessageCard" || got["text"] != testTransition.Message() {
+			t.Fatalf("got %v, want a message card", got)
+		}
+	})
+	t.Run("returns an error if the status is not successful", func(t *testing.T) {
+		srv, _ := newTestReceiver(t, http.StatusInternalServerError)
+		w := &Webhook{URL: srv.URL}
+		err := w.Notify(context.Background(), testTransition)
+		if err == nil || !strings.Contains(err.Error(), "500") {
+			t.Fatalf("got %v, want the status", err)
+		}
+	})
+	t.Run("returns an error if the template is invalid", func(t *testing.T) {
+		w := &Webhook{URL: "http://127.0.0.1", Template: "{{"}
+		err := w.Notify(context.Background(), testTransition)
+		if err == nil || !strings.Contains(err.Error(), "template") {
+			t.Fatalf("got %v, want a template error", err)
+		}
+	})
+	t.Run("returns an error if the context is cancelled", func(t *testing.T) {
+		done := make(chan struct{})
+		hung := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				// Otherwise the server is not aware of the client leaving.
+				_, _ = io.ReadAll(r.Body)
+				select {
+				case <-r.Context().Done():
+				case <-done:
+				}
+			},
+		))
+		defer hung.Close()
+		defer close(done)
+		w := &Webhook{URL: hung.URL}
+		err := w.Notify(cancelSoon(t), testTransition)
+		assertCancelled(t, err)
+	})
+}
+
+func TestCommandNotify(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("shell not available")
+	}
+	t.Run("passes the transition", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out")
+		c := &Command{
+			Name: "sh",
+			Args: []string{
+				"-c", `echo "$UP_EVENT_STATE $UP_EVENT_TARGET $UP_EVENT_OUTAGE" > "$0"; cat >> "$0"`,
+				out,
+			},
+		}
+		err := c.Notify(context.Background(), testTransition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env, input, _ := strings.Cut(string(data), "\n")
+		want := "up 1.1.1.1:53 5m0s"
+		if env != want {
+			t.Fatalf("got %q, want %q", env, want)
+		}
+		var got Transition
+		err = json.Unmarshal([]byte(input), &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != *testTransition {
+			t.Fatalf("got %+v, want %+v", got, *testTransition)
+		}
+	})
+	t.Run("returns an error including the output", func(t *testing.T) {
+		c := &Command{Name: "sh", Args: []string{"-c", "echo broken; exit 1"}}
+		err := c.Notify(context.Background(), testTransition)
+		if err == nil || !strings.Contains(err.Error(), "broken") {
+			t.Fatalf("got %v, want the output", err)
+		}
+	})
+}
+
+// Notifier returning the errors in order, and nil once they are consumed.
+type testNotifier struct {
+	mu    sync.Mutex
+	errs  []error
+	calls int
+}
+
+func (n *testNotifier) Notify(ctx context.Context, t *Transition) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if len(n.errs) == 0 {
+		return nil
+	}
+	err := n.errs[0]
+	n.errs = n.errs[1:]
+	return err
+}
+
+func TestHooksNotify(t *testing.T) {
+	errFailed := errors.New("failed")
+	t.Run("sends to all the notifiers", func(t *testing.T) {
+		srv, bodies := newTestReceiver(t)
+		n := &testNotifier{}
+		h := &Hooks{Notifiers: []Notifier{&Webhook{URL: srv.URL}, n}}
+		err := h.Notify(context.Background(), testTransition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bodies()) != 1 || n.calls != 1 {
+			t.Fatalf("got %d and %d, want 1 and 1", len(bodies()), n.calls)
+		}
+	})
+	t.Run("retries the failed attempts", func(t *testing.T) {
+		srv, bodies := newTestReceiver(
+			t, http.StatusBadGateway, http.StatusServiceUnavailable,
+		)
+		h := &Hooks{
+			Notifiers:  []Notifier{&Webhook{URL: srv.URL}},
+			Retries:    2,
+			RetryDelay: time.Millisecond,
+		}
+		err := h.Notify(context.Background(), testTransition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(bodies()); got != 3 {
+			t.Fatalf("got %d, want 3", got)
+		}
+	})
+	t.Run("returns an error after the retries", func(t *testing.T) {
+		n := &testNotifier{errs: []error{errFailed, errFailed, errFailed}}
+		h := &Hooks{
+			Notifiers: []Notifier{n}, Retries: 2, RetryDelay: time.Millisecond,
+		}
+		err := h.Notify(context.Background(), testTransition)
+		if !errors.Is(err, errFailed) {
+			t.Fatalf("got %v, want %v", err, errFailed)
+		}
+		if n.calls != 3 {
+			t.Fatalf("got %d, want 3", n.calls)
+		}
+	})
+	t.Run("drops the notifications over the rate limit", func(t *testing.T) {
+		n := &testNotifier{}
+		h := &Hooks{Notifiers: []Notifier{n}, RateLimit: 2}
+		for i := range 3 {
+			err := h.Notify(context.Background(), testTransition)
+			if i < 2 && err != nil {
+				t.Fatal(err)
+			}
+			if i == 2 && !errors.Is(err, ErrRateLimited) {
+				t.Fatalf("got %v, want %v", err, ErrRateLimited)
+			}
+		}
+		if n.calls != 2 {
+			t.Fatalf("got %d, want 2", n.calls)
+		}
+	})
+	t.Run("skips the startup without using up the rate limit", func(t *testing.T) {
+		n := &testNotifier{}
+		h := &Hooks{Notifiers: []Notifier{n}, RateLimit: 1}
+		initial := *testTransition
+		initial.From = ""
+		for range 3 {
+			if err := h.Notify(context.Background(), &initial); err != nil {
+				t.Fatal(err)
+			}
+		}
+		down := *testTransition
+		down.State, down.From = StateDown, StateUp
+		if err := h.Notify(context.Background(), &down); err != nil {
+			t.Fatal(err)
+		}
+		if n.calls != 1 {
+			t.Fatalf("got %d, want 1", n.calls)
+		}
+	})
+	t.Run("allows the notifications after a minute", func(t *testing.T) {
+		h := &Hooks{RateLimit: 1}
+		now := time.Now()
+		if !h.allow(now, testTransition) {
+			t.Fatal("got false, want true")
+		}
+		if h.allow(now.Add(time.Second), testTransition) {
+			t.Fatal("got true, want false")
+		}
+		if !h.allow(now.Add(time.Minute), testTransition) {
+			t.Fatal("got false, want true")
+		}
+	})
+	t.Run("allows the recovery of a target notified as down", func(t *testing.T) {
+		h := &Hooks{RateLimit: 1}
+		down := *testTransition
+		down.State, down.From = StateDown, StateUp
+		now := time.Now()
+		if !h.allow(now, &down) {
+			t.Fatal("got false, want true")
+		}
+		if h.allow(now, &down) {
+			t.Fatal("got true, want false")
+		}
+		if !h.allow(now, testTransition) {
+			t.Fatal("got false, want the recovery")
+		}
+		if h.allow(now, testTransition) {
+			t.Fatal("got true, want false")
+		}
+	})
+}
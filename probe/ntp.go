@@ -0,0 +1,149 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Default port of the NTP servers.
+const ntpPort = "123"
+
+// Offset between the NTP (1900) and Unix (1970) epochs, in seconds.
+const ntpEpochOffset = 2208988800
+
+// Clock offset flagged by default.
+const ntpMaxOffset = time.Second
+
+// ErrClockOffset is returned when the local clock is too far from the one of
+// the server.
+var ErrClockOffset = errors.New("clock offset beyond the threshold")
+
+// NTP protocol implementation, as a SNTP client (RFC 4330).
+//
+// A skewed clock breaks TLS and authentication in ways that look like
+// connectivity problems.
+type NTP struct {
+	Timeout time.Duration
+	// Optional. IP address family to use. Any by default.
+	Family Family
+	// Optional. Local end of the connections. The system chooses it by
+	// default.
+	Bind Bind
+	// Optional. Offset of the local clock flagged as a warning. One second
+	// by default.
+	MaxOffset time.Duration
+}
+
+// String returns the identifier of the protocol.
+func (n *NTP) String() string {
+	return "ntp"
+}
+
+// Probe asks a random public NTP server for the time.
+//
+// The target is a host or host:port.
+// The result includes the stratum of the server, the round trip delay and
+// the offset of the local clock. It is also returned if the offset is beyond
+// the threshold, wrapped in ErrClockOffset.
+func (n *NTP) Probe(ctx context.Context, target string) (*Result, error) {
+	server := target
+	if server == "" {
+		var err error
+		server, err = RandomNTPServer()
+		if err != nil {
+			return nil, fmt.Errorf("selecting NTP server: %w", err)
+		}
+	}
+	server = withDefaultPort(server, ntpPort)
+	req, err := ntpRequest()
+	if err != nil {
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+	if n.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.Timeout)
+		defer cancel()
+	}
+	reply, err := udpExchange(
+		ctx, n.Bind, n.Family.network("udp"), server, req, isNTPReply,
+	)
+	if err != nil {
+		return nil, err
+	}
+	resp := reply.data
+	res := &NTPResult{
+		Server:  reply.remoteAddr,
+		Stratum: int(resp[1]),
+		RefID:   ntpRefID(resp),
+	}
+	switch {
+	case res.Stratum == 0:
+		return nil, fmt.Errorf("kiss-o'-death from the server: %s", res.RefID)
+	case resp[0]>>6 == 3:
+		return nil, errors.New("server clock not synchronized")
+	}
+	// Originate, receive, transmit and destination timestamps.
+	t1, t2 := reply.sent, ntpTime(resp[32:])
+	t3, t4 := ntpTime(resp[40:]), reply.received
+	res.Offset = (t2.Sub(t1) + t3.Sub(t4)) / 2
+	res.RTT = t4.Sub(t1) - t3.Sub(t2)
+	result := &Result{Target: server, NTP: res}
+	maxOffset := n.MaxOffset
+	if maxOffset == 0 {
+		maxOffset = ntpMaxOffset
+	}
+	if res.Offset.Abs() > maxOffset {
+		res.Skewed = true
+		return result, fmt.Errorf("%w: %s", ErrClockOffset, res.Offset)
+	}
+	return result, nil
+}
+
+// Returns an SNTP client request (RFC 4330, 4) with a random transmit
+// timestamp, which the server copies in the reply. The local time is not
+// disclosed.
+func ntpRequest() ([]byte, error) {
+	req := make([]byte, 48)
+	// Leap indicator 0, version 4, client mode (3).
+	req[0] = 0x23
+	_, err := rand.Read(req[40:])
+	if err != nil {
+		return nil, fmt.Errorf(tmplRandom, err)
+	}
+	return req, nil
+}
+
+// Checks the server mode (4) and the originate timestamp.
+func isNTPReply(req, resp []byte) bool {
+	return len(resp) >= 48 && resp[0]&0x07 == 4 &&
+		bytes.Equal(req[40:48], resp[24:32])
+}
+
+// Returns the time of an NTP timestamp (RFC 4330, 3). The ones with the most
+// significant bit unset belong to the era starting in 2036.
+func ntpTime(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b))
+	if secs&0x80000000 == 0 {
+		secs += 1 << 32
+	}
+	frac := int64(binary.BigEndian.Uint32(b[4:]))
+	return time.Unix(secs-ntpEpochOffset, frac*1e9>>32)
+}
+
+// Returns the reference identifier of a reply: the source of the time for
+// the primary servers (ie: "GPS"), the IPv4 address of the upstream server
+// (a hash for IPv6) otherwise, or the code of a kiss-o'-death (ie: "RATE").
+func ntpRefID(resp []byte) string {
+	id := resp[12:16]
+	if resp[1] > 1 {
+		return net.IP(id).String()
+	}
+	return strings.TrimRight(string(id), "\x00")
+}
@@ -0,0 +1,166 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Reply of the SNTP server for testing.
+type testNTPReply struct {
+	// Leap indicator.
+	leap    byte
+	stratum byte
+	refID   string
+	// Offset of the server clock.
+	offset time.Duration
+}
+
+// Creates an SNTP server for testing, answering with the reply. Returns its
+// address.
+func newTestNTPServer(t *testing.T, r testNTPReply) string {
+	t.Helper()
+	return newTestUDPServer(t, func(req []byte) [][]byte {
+		now := time.Now().Add(r.offset)
+		resp := make([]byte, 48)
+		// Version 4, server mode (4).
+		resp[0] = r.leap<<6 | 0x24
+		resp[1] = r.stratum
+		copy(resp[12:16], r.refID)
+		copy(resp[24:32], req[40:48])
+		putNTPTime(resp[32:], now)
+		putNTPTime(resp[40:], now)
+		return [][]byte{resp}
+	})
+}
+
+// Writes the NTP timestamp of the time.
+func putNTPTime(b []byte, t time.Time) {
+	secs := uint32(t.Unix() + ntpEpochOffset)
+	frac := uint32((int64(t.Nanosecond()) << 32) / 1e9)
+	binary.BigEndian.PutUint32(b, secs)
+	binary.BigEndian.PutUint32(b[4:], frac)
+}
+
+func TestNTPProbe(t *testing.T) {
+	tout := 1 * time.Second
+	t.Run("returns the offset of the local clock", func(t *testing.T) {
+		addr := newTestNTPServer(t, testNTPReply{
+			stratum: 1, refID: "GPS", offset: 200 * time.Millisecond,
+		})
+		proto := &NTP{Timeout: tout}
+		got, err := proto.Probe(context.Background(), addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := got.NTP
+		if res.Stratum != 1 || res.RefID != "GPS" || res.Server != addr {
+			t.Fatalf("got %+v, want a primary server", res)
+		}
+		if res.Offset < 150*time.Millisecond || res.Offset > 250*time.Millisecond {
+			t.Fatalf("got %s, want around %s", res.Offset, 200*time.Millisecond)
+		}
+		if res.RTT < 0 || res.RTT > tout || res.Skewed {
+			t.Fatalf("got %+v, want a valid delay, not skewed", res)
+		}
+	})
+	t.Run("returns the upstream server as the reference", func(t *testing.T) {
+		addr := newTestNTPServer(t, testNTPReply{
+			stratum: 2, refID: "\xc0\x00\x02\x01",
+		})
+		proto := &NTP{Timeout: tout}
+		got, err := proto.Probe(context.Background(), addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.NTP.RefID != "192.0.2.1" {
+			t.Fatalf("got %q, want %q", got.NTP.RefID, "192.0.2.1")
+		}
+	})
+	t.Run("flags the offset beyond the threshold", func(t *testing.T) {
+		addr := newTestNTPServer(t, testNTPReply{
+			stratum: 1, offset: -time.Hour,
+		})
+		proto := &NTP{Timeout: tout}
+		got, err := proto.Probe(context.Background(), addr)
+		if !errors.Is(err, ErrClockOffset) {
+			t.Fatalf("got %v, want %v", err, ErrClockOffset)
+		}
+		if got == nil || !got.NTP.Skewed || got.NTP.Offset > -59*time.Minute {
+			t.Fatalf("got %+v, want the skewed result", got)
+		}
+	})
+	t.Run("uses the threshold", func(t *testing.T) {
+		addr := newTestNTPServer(t, testNTPReply{
+			stratum: 1, offset: 2 * time.Second,
+		})
+		proto := &NTP{Timeout: tout, MaxOffset: time.Minute}
+		_, err := proto.Probe(context.Background(), addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("returns an error if the server says kiss-o'-death",
+		func(t *testing.T) {
+			addr := newTestNTPServer(t, testNTPReply{refID: "RATE"})
+			proto := &NTP{Timeout: tout}
+			_, err := proto.Probe(context.Background(), addr)
+			if err == nil || !strings.HasSuffix(err.Error(), ": RATE") {
+				t.Fatalf("got %v, want a kiss-o'-death error", err)
+			}
+		},
+	)
+	t.Run("returns an error if the server is not synchronized",
+		func(t *testing.T) {
+			addr := newTestNTPServer(t, testNTPReply{leap: 3, stratum: 16})
+			proto := &NTP{Timeout: tout}
+			_, err := proto.Probe(context.Background(), addr)
+			want := "server clock not synchronized"
+			if err == nil || err.Error() != want {
+				t.Fatalf("got %v, want %q", err, want)
+			}
+		},
+	)
+	t.Run("aborts the attempt if the context is cancelled", func(t *testing.T) {
+		addr := newTestUDPServer(t, func([]byte) [][]byte { return nil })
+		proto := &NTP{Timeout: time.Minute}
+		_, err := proto.Probe(cancelSoon(t), addr)
+		assertCancelled(t, err)
+	})
+}
+
+func TestNTPTime(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		secs uint32
+		want time.Time
+	}{
+		{"the Unix epoch", ntpEpochOffset, time.Unix(0, 0)},
+		{
+			"a time after the rollover of 2036", 1,
+			time.Date(2036, 2, 7, 6, 28, 17, 0, time.UTC),
+		},
+	} {
+		t.Run("returns "+tt.name, func(t *testing.T) {
+			b := make([]byte, 8)
+			binary.BigEndian.PutUint32(b, tt.secs)
+			got := ntpTime(b)
+			if !got.Equal(tt.want) {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRandomNTPServer(t *testing.T) {
+	got, err := RandomNTPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == "" {
+		t.Fatal("got an empty server")
+	}
+}
@@ -1,4 +1,21 @@
-package internal
+// Package probe measures the connectivity of a network using different
+// protocols and public servers.
+//
+// A Runner runs the probes of a set of protocols and targets concurrently:
+//
+//	proto, err := probe.NewProtocol("http", probe.Settings{Timeout: 5 * time.Second})
+//	if err != nil {
+//		return err
+//	}
+//	runner := probe.Runner{Protocols: []probe.Protocol{proto}, Count: 3}
+//	err = runner.Run(ctx, func(r *probe.Report) {
+//		line, _ := r.String(probe.HumanFormat)
+//		fmt.Println(line)
+//	})
+//
+// Custom protocols can be plugged in implementing the Protocol interface and
+// making them available with Register.
+package probe
 
 import (
 	"context"
@@ -9,6 +26,11 @@ import (
 
 // Probe is an experiment to measure the connectivity of a network.
 type Probe struct {
+	// Optional. Used to label the reports.
+	Name string
+	// Optional. Network interface the protocol is bound to, to label the
+	// reports.
+	Interface string
 	// Protocol to use.
 	Proto Protocol
 	// Number of iterations. Zero means infinite.
@@ -20,7 +42,7 @@ type Probe struct {
 	// Channel to send back partial results.
 	ReportCh chan *Report
 	// Optional. Where to point the probe.
-	// URL (HTTP), host/port string (TCP) or domain (DNS).
+	// URL (HTTP), host/port string (TCP and TLS), domain (DNS) or host (ICMP).
 	Target string
 }
 
@@ -45,8 +67,8 @@ func newErrorReqProp(prop string) error {
 
 // Do makes the connection requests against the public servers.
 //
-// The context can be cancelled between different protocol attempts or count
-// iterations.
+// The context can be cancelled at any time, including in the middle of an
+// attempt. Attempts aborted by the cancellation are not reported.
 // Returns an error if the setup is invalid.
 func (p Probe) Do(ctx context.Context) error {
 	err := p.validate()
@@ -71,26 +93,44 @@ func (p Probe) Do(ctx context.Context) error {
 				p.Target,
 			)
 			start := time.Now()
-			target, extra, err := p.Proto.Probe(p.Target)
+			result, err := p.Proto.Probe(ctx, p.Target)
+			if ctx.Err() != nil {
+				p.Logger.Debug("Attempt aborted", "count", count)
+				return nil
+			}
 			var errMsg string
 			if err != nil {
 				errMsg = err.Error()
 			}
 			report := Report{
-				ProtocolID: p.Proto.String(),
-				Time:       time.Since(start),
-				Error:      errMsg,
-				Target:     target,
-				Extra:      extra,
+				Check:        p.Name,
+				Interface:    p.Interface,
+				ProtocolID:   p.Proto.String(),
+				Time:         time.Since(start),
+				Target:       p.Target,
+				RandomTarget: p.Target == "",
+				Error:        errMsg,
+				Result:       result,
+			}
+			if result != nil {
+				report.Target = result.Target
 			}
 			p.Logger.Debug("Sending report back", "report", report)
-			p.ReportCh <- &report
-			time.Sleep(p.Delay)
+			select {
+			case p.ReportCh <- &report:
+			case <-ctx.Done():
+				p.Logger.Debug("Context cancelled", "count", count)
+				return nil
+			}
 			count++
 			if p.Count > 0 && count >= p.Count {
 				p.Logger.Debug("Count limit reached", "count", count)
 				return nil
 			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(p.Delay):
+			}
 		}
 	}
 }
@@ -1,20 +1,22 @@
-package internal
+package probe
 
 import (
 	"context"
 	"log/slog"
 	"testing"
+	"time"
 )
 
 const testHostPort = "127.0.0.1:3355"
-const testExtra = "test-extra"
 
 type testProtocol struct{}
 
 func (p *testProtocol) String() string { return "test-proto" }
 
-func (p *testProtocol) Probe(target string) (string, string, error) {
-	return testHostPort, testExtra, nil
+func (p *testProtocol) Probe(
+	ctx context.Context, target string,
+) (*Result, error) {
+	return &Result{Target: testHostPort}, nil
 }
 
 func TestProbeValidate(t *testing.T) {
@@ -89,6 +91,9 @@ func TestProbeDo(t *testing.T) {
 				if report.Error != "" {
 					t.Errorf("got %q, want nil", report.Error)
 				}
+				if !report.RandomTarget {
+					t.Error("got false, want the target chosen by the protocol")
+				}
 			}
 		}(t)
 		err := p.Do(context.Background())
@@ -110,3 +115,38 @@ func TestProbeDo(t *testing.T) {
 		}
 	})
 }
+
+// Protocol for testing that blocks until the context is cancelled.
+type testHungProtocol struct{}
+
+func (p *testHungProtocol) String() string { return "test-hung-proto" }
+
+func (p *testHungProtocol) Probe(
+	ctx context.Context, target string,
+) (*Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestProbeDoCancel(t *testing.T) {
+	t.Run("aborts the attempt if the context is cancelled", func(t *testing.T) {
+		reportCh := make(chan *Report, 1)
+		defer close(reportCh)
+		p := Probe{
+			Proto: &testHungProtocol{}, Logger: slog.Default(), ReportCh: reportCh,
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		start := time.Now()
+		err := p.Do(ctx)
+		if err != nil {
+			t.Fatalf("got %q, want nil", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("got %s, want the attempt to be abandoned", elapsed)
+		}
+		if len(reportCh) != 0 {
+			t.Fatalf("got %d reports, want 0", len(reportCh))
+		}
+	})
+}
@@ -0,0 +1,385 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol defines a probe attempt.
+type Protocol interface {
+	// Returns the identifier.
+	// Example: "http".
+	String() string
+	// Attempt to check the connectivity to the target.
+	// The target depends on the protocol. For example, for HTTP it's a URL.
+	// The context cancels an in-flight attempt.
+	// Returns the result, including the used target, or error if the attempt
+	// failed.
+	Probe(ctx context.Context, target string) (*Result, error)
+}
+
+// Settings are the options used to create the protocols. Each protocol only
+// uses the ones it supports.
+type Settings struct {
+	// Time to wait for a response.
+	Timeout time.Duration
+	// IP address family to use. Both of them are compared if set to
+	// FamilyBoth.
+	Family Family
+	// Custom DNS resolver (DNS). Example: "tls://1.1.1.1".
+	DNSResolver string
+	// Record type to query (DNS). Example: "MX".
+	DNSType string
+	// HTTP method for DNS-over-HTTPS resolvers (DNS), "GET" or "POST".
+	DoHMethod string
+	// Compare the answers of all the public resolvers (DNS).
+	DNSCompare bool
+	// Type of packets to send (trace): "udp", "tcp" or "icmp".
+	TraceMethod string
+	// Expected response (HTTP).
+	Expect Expectation
+	// URL of the proxy to connect through (HTTP). The one of the environment
+	// by default. Example: "socks5://127.0.0.1:1080".
+	Proxy string
+	// Ignore the proxy of the environment (HTTP).
+	Direct bool
+	// Compare the attempts through the proxy and direct ones (HTTP).
+	ProxyCompare bool
+	// Local end of the connections (HTTP, TCP, DNS, TLS, UDP, NTP and
+	// HTTP/3).
+	Bind Bind
+	// Payload to send (UDP): a built-in one ("dns", "ntp" or "stun") or a
+	// custom text. The one of the target port by default.
+	UDPPayload string
+	// Offset of the local clock flagged as a warning (NTP).
+	NTPMaxOffset time.Duration
+}
+
+// Returns an error if any of the settings is not supported, so it fails
+// before the first attempt.
+func (s Settings) validate() error {
+	err := s.Family.validate()
+	if err != nil {
+		return err
+	}
+	if _, ok := dnsTypes[strings.ToUpper(s.DNSType)]; s.DNSType != "" && !ok {
+		return fmt.Errorf("unsupported record type: %s", s.DNSType)
+	}
+	switch strings.ToUpper(s.DoHMethod) {
+	case "", http.MethodGet, http.MethodPost:
+	default:
+		return fmt.Errorf("unsupported DoH method: %s", s.DoHMethod)
+	}
+	switch s.TraceMethod {
+	case "", "udp", "tcp", "icmp":
+	default:
+		return fmt.Errorf("unsupported trace method: %s", s.TraceMethod)
+	}
+	return nil
+}
+
+// Factory creates a protocol with the given settings.
+type Factory func(s Settings) Protocol
+
+// Registered protocols.
+var registry = struct {
+	sync.RWMutex
+	// Identifiers in order of registration.
+	ids       []string
+	factories map[string]Factory
+}{factories: map[string]Factory{}}
+
+func init() {
+	Register("http", func(s Settings) Protocol {
+		return &HTTP{
+			Timeout: s.Timeout,
+			Family:  s.Family,
+			Bind:    s.Bind,
+			Expect:  s.Expect,
+			Proxy:   s.Proxy,
+			Direct:  s.Direct,
+			Compare: s.ProxyCompare,
+		}
+	})
+	Register("tcp", func(s Settings) Protocol {
+		return &TCP{Timeout: s.Timeout, Family: s.Family, Bind: s.Bind}
+	})
+	Register("dns", func(s Settings) Protocol {
+		return &DNS{
+			Timeout:   s.Timeout,
+			Family:    s.Family,
+			Bind:      s.Bind,
+			Resolver:  s.DNSResolver,
+			Type:      s.DNSType,
+			DoHMethod: s.DoHMethod,
+			Compare:   s.DNSCompare,
+		}
+	})
+	Register("icmp", func(s Settings) Protocol {
+		return &ICMP{Timeout: s.Timeout, Family: s.Family}
+	})
+	Register("tls", func(s Settings) Protocol {
+		return &TLS{Timeout: s.Timeout, Family: s.Family, Bind: s.Bind}
+	})
+	Register("trace", func(s Settings) Protocol {
+		return &Trace{
+			Timeout: s.Timeout, Family: s.Family, Method: s.TraceMethod,
+		}
+	})
+	Register("udp", func(s Settings) Protocol {
+		u := &UDP{Timeout: s.Timeout, Family: s.Family, Bind: s.Bind}
+		if _, ok := udpServices[s.UDPPayload]; ok {
+			u.Service = s.UDPPayload
+		} else if s.UDPPayload != "" {
+			u.Payload = []byte(s.UDPPayload)
+		}
+		return u
+	})
+	Register("ntp", func(s Settings) Protocol {
+		return &NTP{
+			Timeout:   s.Timeout,
+			Family:    s.Family,
+			Bind:      s.Bind,
+			MaxOffset: s.NTPMaxOffset,
+		}
+	})
+	Register("http3", func(s Settings) Protocol {
+		return &HTTP3{Timeout: s.Timeout, Family: s.Family, Bind: s.Bind}
+	})
+}
+
+// Register makes a protocol available by its identifier, so it can be
+// created with NewProtocol. It allows to plug in custom implementations.
+//
+// It panics if the identifier is already registered or the factory is nil.
+func Register(id string, factory Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+	if factory == nil {
+		panic("probe: nil factory for protocol " + id)
+	}
+	if _, ok := registry.factories[id]; ok {
+		panic("probe: protocol already registered: " + id)
+	}
+	registry.ids = append(registry.ids, id)
+	registry.factories[id] = factory
+}
+
+// ProtocolIDs returns the identifiers of the registered protocols, in order
+// of registration. The built-in ones go first.
+func ProtocolIDs() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	return slices.Clone(registry.ids)
+}
+
+// Protocols only checked when asked for. Trace needs raw ICMP sockets, so it
+// fails without privileges.
+var optInProtocolIDs = []string{"trace"}
+
+// DefaultProtocolIDs returns the identifiers of the protocols checked when
+// none is selected: the registered ones, in order, but trace.
+func DefaultProtocolIDs() []string {
+	return slices.DeleteFunc(ProtocolIDs(), func(id string) bool {
+		return slices.Contains(optInProtocolIDs, id)
+	})
+}
+
+// NewProtocol returns the registered protocol with the given identifier.
+//
+// A DualStack one is returned if the family is FamilyBoth.
+// Returns an error if the protocol is not registered or the settings are not
+// supported.
+func NewProtocol(id string, s Settings) (Protocol, error) {
+	registry.RLock()
+	factory, ok := registry.factories[id]
+	registry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown protocol: %s", id)
+	}
+	err := s.validate()
+	if err != nil {
+		return nil, err
+	}
+	if s.Family == FamilyBoth {
+		s4, s6 := s, s
+		s4.Family, s6.Family = FamilyIPv4, FamilyIPv6
+		return &DualStack{IPv4: factory(s4), IPv6: factory(s6)}, nil
+	}
+	return factory(s), nil
+}
+
+// HTTP protocol implementation.
+//
+// Redirections are followed, except for the captive portals, whose location
+// is included in the result.
+type HTTP struct {
+	Timeout time.Duration
+	// Optional. IP address family to use. Any by default.
+	Family Family
+	// Optional. Local end of the connections. The system chooses it by
+	// default.
+	Bind Bind
+	// Optional. Response the target must return. Any by default, except for
+	// the captive portals, which have their own.
+	Expect Expectation
+	// Optional. URL of the proxy to connect through, with the credentials in
+	// the user info if needed. See ParseProxy. The one of the environment
+	// (HTTP_PROXY, HTTPS_PROXY and NO_PROXY) by default.
+	Proxy string
+	// Optional. Connect directly, ignoring the proxy of the environment.
+	Direct bool
+	// Optional. Make each attempt through the proxy and directly, to compare
+	// them.
+	Compare bool
+}
+
+// String returns the identifier of the protocol.
+func (h *HTTP) String() string {
+	return "http"
+}
+
+// Probe makes an HTTP request to a random captive portal.
+//
+// The target is a URL.
+// The result includes the status, the size of the response and the duration
+// of each phase of the request. It is also returned if the response is not
+// the expected one. For captive portals, the error is ErrCaptivePortal.
+// In compare mode, the result includes both attempts instead.
+func (h *HTTP) Probe(ctx context.Context, target string) (*Result, error) {
+	if h.Compare {
+		return h.compare(ctx, target)
+	}
+	transport, usedProxy, err := h.transport()
+	if err != nil {
+		return nil, err
+	}
+	cli := &http.Client{Timeout: h.Timeout, Transport: transport}
+	url := target
+	portal := findCaptivePortal(url)
+	if url == "" {
+		portal, err = RandomCaptivePortal()
+		if err != nil {
+			return nil, fmt.Errorf("selecting captive portal: %w", err)
+		}
+		url = portal.URL.String()
+	}
+	// The redirection is the sign of the interception.
+	if portal != nil {
+		cli.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	expect := h.Expect
+	if portal != nil && expect.isZero() {
+		expect = portal.Expect
+	}
+	trace := newTimingTrace()
+	ctx = httptrace.WithClientTrace(ctx, trace.clientTrace())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	n += int64(len(body))
+	err = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("closing response body: %w", err)
+	}
+	result := &Result{Target: url, HTTP: &HTTPResult{
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		BytesRead:  n,
+		Location:   resp.Header.Get("Location"),
+		Proxy:      usedProxy(),
+	}, Timing: trace.done()}
+	err = expect.check(resp, body)
+	if err == nil {
+		return result, nil
+	}
+	if portal == nil {
+		return result, err
+	}
+	result.HTTP.Captive = true
+	if result.HTTP.Location != "" {
+		return result, fmt.Errorf(
+			"%w: redirected to %s", ErrCaptivePortal, result.HTTP.Location,
+		)
+	}
+	return result, fmt.Errorf("%w: %w", ErrCaptivePortal, err)
+}
+
+// Returns the captive portal with the given URL, nil if it is not one.
+func findCaptivePortal(url string) *CaptivePortal {
+	for _, portal := range CaptivePortals {
+		if portal.URL.String() == url {
+			return portal
+		}
+	}
+	return nil
+}
+
+// TCP protocol implementation.
+type TCP struct {
+	Timeout time.Duration
+	// Optional. IP address family to use. Any by default.
+	Family Family
+	// Optional. Local end of the connections. The system chooses it by
+	// default.
+	Bind Bind
+}
+
+// String returns the identifier of the protocol.
+func (t *TCP) String() string {
+	return "tcp"
+}
+
+// Probe makes a TCP request to a random server.
+//
+// The target is a host:port.
+// The result includes the local and remote addresses.
+func (t *TCP) Probe(ctx context.Context, target string) (*Result, error) {
+	hostPort := target
+	if hostPort == "" {
+		var err error
+		hostPort, err = randomTCPServer(t.Family)
+		if err != nil {
+			return nil, fmt.Errorf("selecting TCP server: %w", err)
+		}
+	}
+	network := t.Family.network("tcp")
+	d := t.Bind.dialer(network, t.Timeout)
+	conn, err := d.DialContext(ctx, network, hostPort)
+	if err != nil {
+		return nil, err
+	}
+	err = conn.Close()
+	if err != nil {
+		return nil, fmt.Errorf("closing connection: %w", err)
+	}
+	return &Result{Target: hostPort, TCP: &TCPResult{
+		LocalAddr:  conn.LocalAddr().String(),
+		RemoteAddr: conn.RemoteAddr().String(),
+	}}, nil
+}
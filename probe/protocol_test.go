@@ -0,0 +1,408 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHTTPProbe(t *testing.T) {
+	tout := 1 * time.Second
+	server := newTestHTTPServer(t)
+	defer server.Close()
+	t.Run(
+		"returns the URL if the request is successful",
+		func(t *testing.T) {
+			u := url.URL{Scheme: "http", Host: server.Addr}
+			proto := HTTP{Timeout: tout}
+			res, err := proto.Probe(context.Background(), u.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "http://127.0.0.1:8080"
+			if res.Target != want {
+				t.Fatalf("got %q, want %q", res.Target, want)
+			}
+			if res.HTTP.Status != "200 OK" {
+				t.Fatalf("got %q, want %q", res.HTTP.Status, "200 OK")
+			}
+			if res.HTTP.StatusCode != http.StatusOK {
+				t.Fatalf("got %d, want %d", res.HTTP.StatusCode, http.StatusOK)
+			}
+			if res.HTTP.BytesRead != int64(len("pong\n")) {
+				t.Fatalf("got %d, want %d", res.HTTP.BytesRead, len("pong\n"))
+			}
+			if res.Timing.Connect == 0 {
+				t.Fatalf("got %s, want > 0", res.Timing.Connect)
+			}
+			if res.Timing.TTFB == 0 {
+				t.Fatalf("got %s, want > 0", res.Timing.TTFB)
+			}
+			if res.Timing.Total < res.Timing.TTFB {
+				t.Fatalf("got %s, want >= %s", res.Timing.Total, res.Timing.TTFB)
+			}
+		},
+	)
+	t.Run("returns an error if the request fails", func(t *testing.T) {
+		u := url.URL{Scheme: "http", Host: "localhost"}
+		proto := HTTP{Timeout: 1}
+		res, err := proto.Probe(context.Background(), u.String())
+		if res != nil {
+			t.Fatalf("got %v should be nil", res)
+		}
+		got := err.Error()
+		want := `Get "http://localhost": context deadline exceeded (Client.Timeout exceeded while awaiting headers)`
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run(
+		"returns the result and an error if the status is unexpected",
+		func(t *testing.T) {
+			u := url.URL{Scheme: "http", Host: server.Addr}
+			proto := HTTP{
+				Timeout: tout,
+				Expect:  Expectation{Status: http.StatusNoContent},
+			}
+			res, err := proto.Probe(context.Background(), u.String())
+			want := "unexpected status: got 200, want 204"
+			if err == nil || err.Error() != want {
+				t.Fatalf("got %v, want %q", err, want)
+			}
+			if res.HTTP.StatusCode != http.StatusOK {
+				t.Fatalf("got %d, want %d", res.HTTP.StatusCode, http.StatusOK)
+			}
+		},
+	)
+	t.Run("follows redirections", func(t *testing.T) {
+		moved := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/new" {
+					http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+					return
+				}
+				io.WriteString(w, "pong\n")
+			},
+		))
+		defer moved.Close()
+		proto := HTTP{Timeout: tout}
+		res, err := proto.Probe(context.Background(), moved.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.HTTP.StatusCode != http.StatusOK || res.HTTP.Location != "" {
+			t.Fatalf("got %+v, want the response of the new location", res.HTTP)
+		}
+		if res.HTTP.Captive {
+			t.Fatal("got captive, want a regular target")
+		}
+	})
+	t.Run("detects an intercepted captive portal", func(t *testing.T) {
+		portal := newTestPortalServer(t)
+		defer portal.Close()
+		u, err := url.Parse(portal.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		portals := CaptivePortals
+		t.Cleanup(func() { CaptivePortals = portals })
+		CaptivePortals = []*CaptivePortal{
+			{URL: u, Expect: Expectation{Status: http.StatusNoContent}},
+		}
+		proto := HTTP{Timeout: tout}
+		res, err := proto.Probe(context.Background(), "")
+		if !errors.Is(err, ErrCaptivePortal) {
+			t.Fatalf("got %v, want %v", err, ErrCaptivePortal)
+		}
+		want := "captive portal detected: redirected to http://portal.test/login"
+		if err.Error() != want {
+			t.Fatalf("got %q, want %q", err, want)
+		}
+		if res.Target != portal.URL {
+			t.Fatalf("got %q, want %q", res.Target, portal.URL)
+		}
+		if !res.HTTP.Captive {
+			t.Fatal("got not captive, want captive")
+		}
+	})
+	t.Run("aborts the request if the context is cancelled", func(t *testing.T) {
+		hung := newTestHungHTTPServer(t)
+		defer hung.Close()
+		proto := HTTP{Timeout: time.Minute}
+		_, err := proto.Probe(cancelSoon(t), hung.URL)
+		assertCancelled(t, err)
+	})
+}
+
+// Creates an HTTP server for testing that redirects to a login page, like the
+// captive portals do.
+func newTestPortalServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://portal.test/login", http.StatusFound)
+		},
+	))
+}
+
+// Creates an HTTP server for testing that never answers.
+func newTestHungHTTPServer(t *testing.T) *httptest.Server {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+		},
+	))
+	t.Cleanup(func() { close(done) })
+	return server
+}
+
+// Returns a context cancelled shortly after the start of the attempt.
+func cancelSoon(t *testing.T) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	return ctx
+}
+
+// Fails if the error is not caused by a cancelled context.
+func assertCancelled(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+// Creates an HTTP server for testing.
+func newTestHTTPServer(t *testing.T) *http.Server {
+	hostPort := net.JoinHostPort("127.0.0.1", "8080")
+	server := &http.Server{Addr: hostPort}
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "pong\n")
+	})
+	l, err := net.Listen("tcp", hostPort)
+	if err != nil {
+		t.Fatalf("create listener %v", err)
+	}
+	go func() {
+		err := server.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			t.Errorf("starting http server: %v", err)
+		}
+	}()
+	return server
+}
+
+func TestNewProtocol(t *testing.T) {
+	t.Run("returns the built-in protocols", func(t *testing.T) {
+		for _, id := range []string{
+			"http", "tcp", "dns", "icmp", "tls", "trace", "udp", "ntp",
+			"http3",
+		} {
+			proto, err := NewProtocol(id, Settings{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if proto.String() != id {
+				t.Fatalf("got %q, want %q", proto.String(), id)
+			}
+		}
+	})
+	t.Run("returns an error if the protocol is unknown", func(t *testing.T) {
+		_, err := NewProtocol("foo", Settings{})
+		want := "unknown protocol: foo"
+		if err == nil || err.Error() != want {
+			t.Fatalf("got %v, want %q", err, want)
+		}
+	})
+	t.Run("restricts the protocol to the address family", func(t *testing.T) {
+		proto, err := NewProtocol("tcp", Settings{Family: FamilyIPv6})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proto.(*TCP).Family != FamilyIPv6 {
+			t.Fatalf("got %q, want %q", proto.(*TCP).Family, FamilyIPv6)
+		}
+	})
+	t.Run("returns a dual-stack protocol for both families", func(t *testing.T) {
+		proto, err := NewProtocol("tcp", Settings{Family: FamilyBoth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dual := proto.(*DualStack)
+		if dual.IPv4.(*TCP).Family != FamilyIPv4 {
+			t.Fatalf("got %q, want %q", dual.IPv4.(*TCP).Family, FamilyIPv4)
+		}
+		if dual.IPv6.(*TCP).Family != FamilyIPv6 {
+			t.Fatalf("got %q, want %q", dual.IPv6.(*TCP).Family, FamilyIPv6)
+		}
+		if proto.String() != "tcp" {
+			t.Fatalf("got %q, want %q", proto.String(), "tcp")
+		}
+	})
+	t.Run("returns an error if the family is unknown", func(t *testing.T) {
+		_, err := NewProtocol("tcp", Settings{Family: "5"})
+		want := "unsupported address family: 5"
+		if err == nil || err.Error() != want {
+			t.Fatalf("got %v, want %q", err, want)
+		}
+	})
+	t.Run("returns an error if a setting is unknown", func(t *testing.T) {
+		for _, tt := range []struct {
+			s    Settings
+			want string
+		}{
+			{Settings{DNSType: "FOO"}, "unsupported record type: FOO"},
+			{Settings{DoHMethod: "PUT"}, "unsupported DoH method: PUT"},
+			{Settings{TraceMethod: "sctp"}, "unsupported trace method: sctp"},
+		} {
+			_, err := NewProtocol("dns", tt.s)
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("got %v, want %q", err, tt.want)
+			}
+		}
+	})
+}
+
+func TestRegister(t *testing.T) {
+	t.Run("makes a custom protocol available", func(t *testing.T) {
+		Register("test-proto", func(Settings) Protocol {
+			return &testProtocol{}
+		})
+		proto, err := NewProtocol("test-proto", Settings{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proto.String() != "test-proto" {
+			t.Fatalf("got %q, want %q", proto.String(), "test-proto")
+		}
+		ids := ProtocolIDs()
+		if ids[len(ids)-1] != "test-proto" {
+			t.Fatalf("got %v, want it to end with %q", ids, "test-proto")
+		}
+	})
+	t.Run("leaves trace out of the default protocols", func(t *testing.T) {
+		ids := DefaultProtocolIDs()
+		if slices.Contains(ids, "trace") {
+			t.Fatalf("got %v, want it without %q", ids, "trace")
+		}
+		if !slices.Contains(ids, "http") {
+			t.Fatalf("got %v, want it to include %q", ids, "http")
+		}
+	})
+	t.Run("panics if the protocol is already registered", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("got no panic")
+			}
+		}()
+		Register("http", func(Settings) Protocol { return &HTTP{} })
+	})
+}
+
+func TestTCPProbe(t *testing.T) {
+	tout := 1 * time.Second
+	listen := newTestTCPServer(t)
+	defer listen.Close()
+	go func() {
+		connection, err := listen.Accept()
+		if err != nil {
+			fmt.Println("Error: ", err.Error())
+			return
+		}
+		go func(conn net.Conn) {
+			conn.Write([]byte("pong"))
+			conn.Close()
+		}(connection)
+	}()
+	hostPort := listen.Addr().String()
+	t.Run(
+		"returns the remote host/port if the request is successful",
+		func(t *testing.T) {
+			proto := &TCP{Timeout: tout}
+			res, err := proto.Probe(context.Background(), hostPort)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Target != hostPort {
+				t.Fatalf("got %q, want %q", res.Target, hostPort)
+			}
+			if res.TCP.RemoteAddr != hostPort {
+				t.Fatalf("got %q, want %q", res.TCP.RemoteAddr, hostPort)
+			}
+			host, port, err := net.SplitHostPort(res.TCP.LocalAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if host != "127.0.0.1" {
+				t.Fatalf("got %q, want %q", host, "127.0.0.1")
+			}
+			if port == "" {
+				t.Fatalf("got %q, want a valid port", port)
+			}
+		},
+	)
+	t.Run("returns an error if the request fails", func(t *testing.T) {
+		proto := &TCP{Timeout: 1}
+		res, err := proto.Probe(context.Background(), "localhost:80")
+		if err == nil {
+			t.Fatal("got nil, want an error")
+		}
+		if res != nil {
+			t.Fatalf("got %v should be nil", res)
+		}
+		got := err.Error()
+		want := "dial tcp: lookup localhost: i/o timeout"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("uses only the address family", func(t *testing.T) {
+		listen6, err := net.Listen("tcp6", "[::1]:0")
+		if err != nil {
+			t.Skipf("IPv6 not available: %v", err)
+		}
+		defer listen6.Close()
+		hostPort6 := listen6.Addr().String()
+		proto := &TCP{Timeout: tout, Family: FamilyIPv6}
+		res, err := proto.Probe(context.Background(), hostPort6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.TCP.RemoteAddr != hostPort6 {
+			t.Fatalf("got %q, want %q", res.TCP.RemoteAddr, hostPort6)
+		}
+		proto = &TCP{Timeout: tout, Family: FamilyIPv4}
+		_, err = proto.Probe(context.Background(), hostPort6)
+		if err == nil {
+			t.Fatal("got nil, want an error")
+		}
+	})
+	t.Run("aborts the dial if the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		proto := &TCP{Timeout: time.Minute}
+		_, err := proto.Probe(ctx, hostPort)
+		assertCancelled(t, err)
+	})
+}
+
+// Creates a TCP server for testing.
+func newTestTCPServer(t *testing.T) net.Listener {
+	hostPort := net.JoinHostPort("127.0.0.1", "8081")
+	listen, err := net.Listen("tcp", hostPort)
+	if err != nil {
+		t.Fatalf("starting tcp server: %v", err)
+	}
+	return listen
+}
@@ -0,0 +1,229 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Format is the output format of the report.
+type Format int
+
+const (
+	HumanFormat Format = iota
+	JSONFormat
+	GrepFormat
+)
+
+// Status is the outcome of a connection attempt.
+type Status string
+
+const (
+	// A response was received.
+	StatusOK Status = "ok"
+	// The attempt failed.
+	StatusError Status = "error"
+	// The attempt failed because a captive portal intercepted it.
+	StatusCaptive Status = "captive"
+	// A response was received, but it shows a problem: the local clock is
+	// skewed or HTTP/3 falls back to TCP.
+	StatusWarning Status = "warning"
+	// A node on the path answered, but not the destination (trace).
+	StatusHop Status = "hop"
+)
+
+// Report is the result of a connection attempt.
+//
+// The property 'Result' is set if a response was received, and 'Error' if
+// the attempt failed. Both of them are set when the response shows a problem,
+// as an untrusted certificate or a captive portal. See Status.
+type Report struct {
+	// Name of the check, if any.
+	Check string `json:"check,omitempty"`
+	// Network interface used, if bound to one.
+	Interface string `json:"interface,omitempty"`
+	// Protocol used to connect to.
+	ProtocolID string `json:"protocol"`
+	// Target used to connect to.
+	Target string `json:"target"`
+	// The target was chosen by the protocol, from its public servers. Each
+	// attempt can use a different one.
+	RandomTarget bool `json:"random_target,omitempty"`
+	// Response time.
+	Time time.Duration `json:"time"`
+	// Network error, or the problem shown by the response.
+	Error string `json:"error,omitempty"`
+	// Information gathered. Depends on the protocol. It can be set even if
+	// the attempt failed.
+	Result *Result `json:"result,omitempty"`
+}
+
+// Target used to group the reports of the probes without one, because each
+// attempt can use a different public server.
+const randomTargets = "random"
+
+// Returns the target the report is grouped by when aggregating it with the
+// others.
+func (r *Report) groupTarget() string {
+	if r.RandomTarget {
+		return randomTargets
+	}
+	return r.Target
+}
+
+// Status returns the outcome of the attempt: hop if a trace reply comes from a
+// node which is not the destination, ok without error, captive or warning if
+// the result flags the problem as such, and error otherwise, even if there is
+// a result.
+func (r *Report) Status() Status {
+	switch {
+	case r.Error == "" && r.Result != nil && r.Result.Trace != nil &&
+		!r.Result.Trace.Reached:
+		return StatusHop
+	case r.Error == "":
+		return StatusOK
+	case r.Result != nil && r.Result.HTTP != nil && r.Result.HTTP.Captive:
+		return StatusCaptive
+	case r.Result != nil && r.Result.NTP != nil && r.Result.NTP.Skewed:
+		return StatusWarning
+	case r.Result != nil && r.Result.HTTP3 != nil && r.Result.HTTP3.Fallback:
+		return StatusWarning
+	default:
+		return StatusError
+	}
+}
+
+// Succeeded returns true if the status is ok or a warning, as a response was
+// received and it is usable. It is the rule of the statistics, the metrics,
+// the monitor and the history.
+func (r *Report) Succeeded() bool {
+	status := r.Status()
+	return status == StatusOK || status == StatusWarning
+}
+
+// String returns the report ready to be printed.
+func (r *Report) String(format Format) (string, error) {
+	switch format {
+	case HumanFormat:
+		return r.stringHuman(), nil
+	case JSONFormat:
+		line, err := r.stringJSON()
+		if err != nil {
+			return "", fmt.Errorf("error generating JSON report: %w", err)
+		}
+		return line, nil
+	case GrepFormat:
+		return r.stringGrep(), nil
+	default:
+		return "", fmt.Errorf("unsupported format: %v", format)
+	}
+}
+
+// Returns the report in JSON format.
+// Example:
+// '{"protocol":"tcp","target":"64.6.65.6:53","time":13433165,"result":{"tcp":{"local_addr":"192.168.1.177:39384","remote_addr":"64.6.65.6:53"}}}'
+func (r *Report) stringJSON() (string, error) {
+	reportJSON, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("marshaling report: %w", err)
+	}
+	return string(reportJSON), nil
+}
+
+// Returns the report in human readable format.
+// Example: '✔ tcp    100.077875ms   77.88.8.8:53 (192.168.1.177:43586)
+// Protocols measuring phases append them. Example:
+// '✔ http   45.2ms   http://example.com (200 OK) dns=2ms connect=20ms tls=0s ttfb=21ms total=45ms'
+// Reports of a check start with its name, and the interface used follows the
+// protocol. Example:
+// '✔ [portal] http@eth0 45.2ms   http://example.com (200 OK)'
+func (r *Report) stringHuman() string {
+	line := fmt.Sprintf(
+		"%-15s %-14s %s",
+		bold(withInterface(r.ProtocolID, r.Interface)), r.Time, r.Target,
+	)
+	if r.Check != "" {
+		line = fmt.Sprintf("[%s] %s", r.Check, line)
+	}
+	suffix := r.Result.Summary()
+	var prefix string
+	switch r.Status() {
+	case StatusOK:
+		prefix = green("✔")
+	case StatusHop:
+		prefix = "→"
+	case StatusCaptive, StatusWarning:
+		prefix = yellow("⚠")
+		suffix = r.Error
+	default:
+		prefix = red("✘")
+		suffix = r.Error
+	}
+	suffix = fmt.Sprintf("(%s)", suffix)
+	if timing := r.timing(); timing != nil {
+		suffix = fmt.Sprintf("%s %s", suffix, strings.Join(timing.fields(), " "))
+	}
+	return fmt.Sprintf("%s %s %s", prefix, line, faint(suffix))
+}
+
+var (
+	green  = color.New(color.FgGreen).SprintFunc()
+	red    = color.New(color.FgRed).SprintFunc()
+	yellow = color.New(color.FgYellow).SprintFunc()
+	bold   = color.New(color.Bold).SprintFunc()
+	faint  = color.New(color.Faint).SprintFunc()
+)
+
+// Returns the report in a grepable format.
+//
+// Example: 'tcp     13.944825ms     195.46.39.40:53 success 192.168.1.177:43296
+// The status is one of the Status values. Example: 'captive'.
+// Protocols measuring phases append a column for each one, using the same
+// 'key=value' notation as the human readable format. Reports through an
+// interface and of a check append them as the last columns. Example:
+// 'interface=eth0	check=portal'.
+func (r *Report) stringGrep() string {
+	status := r.Status()
+	suffix := r.Result.Summary()
+	if r.Error != "" {
+		suffix = r.Error
+	}
+	line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s",
+		r.ProtocolID, r.Time, r.Target, status, suffix,
+	)
+	if timing := r.timing(); timing != nil {
+		line = fmt.Sprintf("%s\t%s", line, strings.Join(timing.fields(), "\t"))
+	}
+	return withLabels(line, r.Interface, r.Check)
+}
+
+// Returns the protocol followed by the interface, if any. Example: 'tcp@eth0'.
+func withInterface(protocolID, iface string) string {
+	if iface == "" {
+		return protocolID
+	}
+	return protocolID + "@" + iface
+}
+
+// Appends the interface and the check to a grepable line, if any.
+func withLabels(line, iface, check string) string {
+	if iface != "" {
+		line = fmt.Sprintf("%s\tinterface=%s", line, iface)
+	}
+	if check != "" {
+		line = fmt.Sprintf("%s\tcheck=%s", line, check)
+	}
+	return line
+}
+
+// Returns the duration of each phase, nil if the protocol does not measure
+// them.
+func (r *Report) timing() *Timing {
+	if r.Result == nil {
+		return nil
+	}
+	return r.Result.Timing
+}
@@ -0,0 +1,384 @@
+package probe
+
+import (
+	"testing"
+)
+
+func TestReportString(t *testing.T) {
+	r := Report{
+		ProtocolID: "tcp",
+		Target:     "127.0.0.1:80",
+		Time:       1,
+		Result:     &Result{TCP: &TCPResult{LocalAddr: "extra-0"}},
+	}
+	t.Run("returns a report using human format", func(t *testing.T) {
+		got, err := r.String(HumanFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "✔ tcp             1ns            127.0.0.1:80 (extra-0)"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("returns a report using JSON format", func(t *testing.T) {
+		got, err := r.String(JSONFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"protocol":"tcp","target":"127.0.0.1:80","time":1,"result":{"tcp":{"local_addr":"extra-0","remote_addr":""}}}`
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("returns a report using a grepable format", func(t *testing.T) {
+		got, err := r.String(GrepFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "tcp\t1ns\t127.0.0.1:80\tok\textra-0"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestStringJSON(t *testing.T) {
+	r := Report{
+		ProtocolID: "tcp",
+		Target:     "127.0.0.1:80",
+		Time:       1,
+		Result:     &Result{TCP: &TCPResult{LocalAddr: "extra-0"}},
+	}
+	t.Run("returns JSON format for successful probes", func(t *testing.T) {
+		got, err := r.stringJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"protocol":"tcp","target":"127.0.0.1:80","time":1,"result":{"tcp":{"local_addr":"extra-0","remote_addr":""}}}`
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("returns JSON format for failed probes", func(t *testing.T) {
+		rErr := r
+		rErr.Result = nil
+		rErr.Error = "error-0"
+		got, err := rErr.stringJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"protocol":"tcp","target":"127.0.0.1:80","time":1,"error":"error-0"}`
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("omits the unknown certificate expiration", func(t *testing.T) {
+		rTLS := r
+		rTLS.ProtocolID = "tls"
+		rTLS.Result = &Result{TLS: &TLSResult{Version: "TLS 1.3"}}
+		got, err := rTLS.stringJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"protocol":"tls","target":"127.0.0.1:80","time":1,"result":{"tls":{"version":"TLS 1.3","cipher_suite":""}}}`
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestStringHuman(t *testing.T) {
+	r := Report{
+		ProtocolID: "tcp",
+		Target:     "127.0.0.1:80",
+		Time:       1,
+		Result:     &Result{TCP: &TCPResult{LocalAddr: "extra-0"}},
+	}
+	t.Run("returns human readable format for successful probes",
+		func(t *testing.T) {
+			got := r.stringHuman()
+			want := "✔ tcp             1ns            127.0.0.1:80 (extra-0)"
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		},
+	)
+	t.Run("returns human readable format for failed probes",
+		func(t *testing.T) {
+			rErr := r
+			rErr.Result = nil
+			rErr.Error = "error-0"
+			got := rErr.stringHuman()
+			want := "✘ tcp             1ns            127.0.0.1:80 (error-0)"
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		},
+	)
+}
+
+func TestStringGrep(t *testing.T) {
+	r := Report{
+		ProtocolID: "tcp",
+		Target:     "127.0.0.1:80",
+		Time:       1,
+		Result:     &Result{TCP: &TCPResult{LocalAddr: "extra-0"}},
+	}
+	t.Run("returns grep format for successful probes", func(t *testing.T) {
+		got := r.stringGrep()
+		want := "tcp\t1ns\t127.0.0.1:80\tok\textra-0"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("returns grep format for failed probes", func(t *testing.T) {
+		rErr := r
+		rErr.Result = nil
+		rErr.Error = "error-0"
+		got := rErr.stringGrep()
+		want := "tcp\t1ns\t127.0.0.1:80\terror\terror-0"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestReportStringTiming(t *testing.T) {
+	r := Report{
+		ProtocolID: "http",
+		Target:     "http://127.0.0.1",
+		Time:       5,
+		Result: &Result{
+			HTTP: &HTTPResult{Status: "200 OK"},
+			Timing: &Timing{
+				DNS: 1, Connect: 2, TLS: 0, TTFB: 3, Total: 5,
+			},
+		},
+	}
+	t.Run("appends the phases to the human format", func(t *testing.T) {
+		got := r.stringHuman()
+		want := "✔ http            5ns            http://127.0.0.1 (200 OK) dns=1ns connect=2ns tls=0s ttfb=3ns total=5ns"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("appends the phases to the grepable format", func(t *testing.T) {
+		got := r.stringGrep()
+		want := "http\t5ns\thttp://127.0.0.1\tok\t200 OK\tdns=1ns\tconnect=2ns\ttls=0s\tttfb=3ns\ttotal=5ns"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("includes the phases in the JSON format", func(t *testing.T) {
+		got, err := r.stringJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"protocol":"http","target":"http://127.0.0.1","time":5,"result":{"http":{"status":"200 OK","status_code":0,"proto":"","bytes_read":0},"timing":{"dns":1,"connect":2,"tls":0,"ttfb":3,"total":5}}}`
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestReportStringTrace(t *testing.T) {
+	r := Report{
+		ProtocolID: "trace",
+		Target:     "1.1.1.1",
+		Time:       5,
+		Result:     &Result{Trace: &TraceResult{Hop: 2, Addr: "10.0.0.1"}},
+	}
+	t.Run("includes the hop in the human format", func(t *testing.T) {
+		got := r.stringHuman()
+		want := "→ trace           5ns            1.1.1.1 (hop=2 addr=10.0.0.1)"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("includes the hop in the grepable format", func(t *testing.T) {
+		got := r.stringGrep()
+		want := "trace\t5ns\t1.1.1.1\thop\thop=2 addr=10.0.0.1"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("includes the hop in the JSON format", func(t *testing.T) {
+		got, err := r.stringJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"protocol":"trace","target":"1.1.1.1","time":5,"result":{"trace":{"hop":2,"addr":"10.0.0.1","reached":false}}}`
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestReportStringCheck(t *testing.T) {
+	r := Report{
+		Check:      "loopback",
+		ProtocolID: "tcp",
+		Target:     "127.0.0.1:80",
+		Time:       1,
+		Result:     &Result{TCP: &TCPResult{LocalAddr: "extra-0"}},
+	}
+	t.Run("starts the human format with the check", func(t *testing.T) {
+		got := r.stringHuman()
+		want := "✔ [loopback] tcp             1ns            127.0.0.1:80 (extra-0)"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("appends the check to the grepable format", func(t *testing.T) {
+		got := r.stringGrep()
+		want := "tcp\t1ns\t127.0.0.1:80\tok\textra-0\tcheck=loopback"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("includes the check in the JSON format", func(t *testing.T) {
+		got, err := r.stringJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"check":"loopback","protocol":"tcp","target":"127.0.0.1:80","time":1,"result":{"tcp":{"local_addr":"extra-0","remote_addr":""}}}`
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestReportStringInterface(t *testing.T) {
+	r := Report{
+		Check:      "loopback",
+		Interface:  "eth0",
+		ProtocolID: "tcp",
+		Target:     "127.0.0.1:80",
+		Time:       1,
+		Result:     &Result{TCP: &TCPResult{LocalAddr: "extra-0"}},
+	}
+	t.Run("appends the interface to the protocol", func(t *testing.T) {
+		got := r.stringHuman()
+		want := "✔ [loopback] tcp@eth0        1ns            127.0.0.1:80 (extra-0)"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("appends the interface to the grepable format", func(t *testing.T) {
+		got := r.stringGrep()
+		want := "tcp\t1ns\t127.0.0.1:80\tok\textra-0\tinterface=eth0\tcheck=loopback"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestReportStatus(t *testing.T) {
+	t.Run("returns ok for successful probes", func(t *testing.T) {
+		r := Report{}
+		if r.Status() != StatusOK {
+			t.Fatalf("got %q, want %q", r.Status(), StatusOK)
+		}
+	})
+	t.Run("returns error for failed probes", func(t *testing.T) {
+		r := Report{Error: "error-0"}
+		if r.Status() != StatusError {
+			t.Fatalf("got %q, want %q", r.Status(), StatusError)
+		}
+	})
+	t.Run("returns captive for intercepted probes", func(t *testing.T) {
+		r := Report{
+			ProtocolID: "http",
+			Target:     "http://127.0.0.1",
+			Time:       1,
+			Error:      "captive portal detected",
+			Result:     &Result{HTTP: &HTTPResult{Captive: true}},
+		}
+		if r.Status() != StatusCaptive {
+			t.Fatalf("got %q, want %q", r.Status(), StatusCaptive)
+		}
+		got := r.stringHuman()
+		want := "⚠ http            1ns            http://127.0.0.1 (captive portal detected)"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+		got = r.stringGrep()
+		want = "http\t1ns\thttp://127.0.0.1\tcaptive\tcaptive portal detected"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("returns warning for skewed clocks", func(t *testing.T) {
+		r := Report{
+			ProtocolID: "ntp",
+			Target:     "127.0.0.1:123",
+			Time:       1,
+			Error:      "clock offset beyond the threshold: 1h0m0s",
+			Result:     &Result{NTP: &NTPResult{Skewed: true}},
+		}
+		if r.Status() != StatusWarning {
+			t.Fatalf("got %q, want %q", r.Status(), StatusWarning)
+		}
+		got := r.stringHuman()
+		want := "⚠ ntp             1ns            127.0.0.1:123 (clock offset beyond the threshold: 1h0m0s)"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+		got = r.stringGrep()
+		want = "ntp\t1ns\t127.0.0.1:123\twarning\tclock offset beyond the threshold: 1h0m0s"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("returns warning for HTTP/3 falling back to TCP", func(t *testing.T) {
+		r := Report{
+			ProtocolID: "http3",
+			Error:      "HTTP/3 not working, falling back to TCP: timeout",
+			Result:     &Result{HTTP3: &HTTP3Result{Fallback: true}},
+		}
+		if r.Status() != StatusWarning {
+			t.Fatalf("got %q, want %q", r.Status(), StatusWarning)
+		}
+	})
+	t.Run("returns hop for a trace reply not from the destination", func(t *testing.T) {
+		r := Report{Result: &Result{Trace: &TraceResult{Hop: 1, Addr: "192.0.2.1"}}}
+		if r.Status() != StatusHop {
+			t.Fatalf("got %q, want %q", r.Status(), StatusHop)
+		}
+		r.Result.Trace.Reached = true
+		if r.Status() != StatusOK {
+			t.Fatalf("got %q, want %q", r.Status(), StatusOK)
+		}
+	})
+}
+
+func TestReportSucceeded(t *testing.T) {
+	t.Run("returns true for ok and warning reports", func(t *testing.T) {
+		for _, r := range []Report{
+			{},
+			{
+				Error:  "clock offset beyond the threshold: 1h0m0s",
+				Result: &Result{NTP: &NTPResult{Skewed: true}},
+			},
+		} {
+			if !r.Succeeded() {
+				t.Fatalf("got false for %q, want true", r.Status())
+			}
+		}
+	})
+	t.Run("returns false for error, captive and hop reports", func(t *testing.T) {
+		for _, r := range []Report{
+			{Error: "error-0"},
+			{Result: &Result{Trace: &TraceResult{Hop: 1, Addr: "192.0.2.1"}}},
+			{
+				Error:  "captive portal detected",
+				Result: &Result{HTTP: &HTTPResult{Captive: true}},
+			},
+		} {
+			if r.Succeeded() {
+				t.Fatalf("got true for %q, want false", r.Status())
+			}
+		}
+	})
+}
@@ -0,0 +1,401 @@
+package probe
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Result is the information gathered by a successful probe attempt.
+//
+// Only the property of the protocol used is set.
+type Result struct {
+	// Target used to connect to.
+	Target string       `json:"-"`
+	HTTP   *HTTPResult  `json:"http,omitempty"`
+	TCP    *TCPResult   `json:"tcp,omitempty"`
+	DNS    *DNSResult   `json:"dns,omitempty"`
+	ICMP   *ICMPResult  `json:"icmp,omitempty"`
+	TLS    *TLSResult   `json:"tls,omitempty"`
+	Trace  *TraceResult `json:"trace,omitempty"`
+	UDP    *UDPResult   `json:"udp,omitempty"`
+	NTP    *NTPResult   `json:"ntp,omitempty"`
+	HTTP3  *HTTP3Result `json:"http3,omitempty"`
+	// Comparison of IPv4 and IPv6, in dual-stack mode.
+	DualStack *DualStackResult `json:"dual_stack,omitempty"`
+	// Comparison of the attempts through the proxy and direct ones.
+	ProxyComparison *ProxyComparison `json:"proxy_comparison,omitempty"`
+	// Duration of each phase. Only set by some protocols.
+	Timing *Timing `json:"timing,omitempty"`
+}
+
+// Summary returns a short description of the result, to be used in the
+// human readable and grepable formats.
+func (r *Result) Summary() string {
+	switch {
+	case r == nil:
+		return ""
+	case r.DualStack != nil:
+		return r.DualStack.summary()
+	case r.ProxyComparison != nil:
+		return r.ProxyComparison.summary()
+	case r.HTTP != nil:
+		return r.HTTP.summary()
+	case r.TCP != nil:
+		return r.TCP.LocalAddr
+	case r.DNS != nil:
+		return r.DNS.summary()
+	case r.ICMP != nil:
+		return fmt.Sprintf("seq=%d ttl=%d", r.ICMP.Seq, r.ICMP.TTL)
+	case r.TLS != nil:
+		return r.TLS.summary()
+	case r.Trace != nil:
+		return r.Trace.summary()
+	case r.UDP != nil:
+		return r.UDP.summary()
+	case r.NTP != nil:
+		return fmt.Sprintf(
+			"stratum=%d offset=%s rtt=%s", r.NTP.Stratum, r.NTP.Offset, r.NTP.RTT,
+		)
+	case r.HTTP3 != nil:
+		return r.HTTP3.summary()
+	default:
+		return ""
+	}
+}
+
+// HTTPResult is the information gathered by the HTTP protocol.
+type HTTPResult struct {
+	// Status line. Example: "200 OK".
+	Status string `json:"status"`
+	// Status code. Example: 200.
+	StatusCode int `json:"status_code"`
+	// Protocol version. Example: "HTTP/1.1".
+	Proto string `json:"proto"`
+	// Size of the response body.
+	BytesRead int64 `json:"bytes_read"`
+	// Redirection target, if it was not followed.
+	Location string `json:"location,omitempty"`
+	// The response of a captive portal detection URL was intercepted.
+	Captive bool `json:"captive,omitempty"`
+	// Proxy the request went through, without the password. Empty for direct
+	// connections.
+	Proxy string `json:"proxy,omitempty"`
+}
+
+func (r *HTTPResult) summary() string {
+	if r.Proxy == "" {
+		return r.Status
+	}
+	return fmt.Sprintf("%s proxy=%s", r.Status, r.Proxy)
+}
+
+// TCPResult is the information gathered by the TCP protocol.
+type TCPResult struct {
+	// Local address of the connection.
+	LocalAddr string `json:"local_addr"`
+	// Remote address of the connection.
+	RemoteAddr string `json:"remote_addr"`
+}
+
+// DNSResult is the information gathered by the DNS protocol.
+type DNSResult struct {
+	// Response code. Example: "NXDOMAIN".
+	Rcode string `json:"rcode"`
+	// All the answers.
+	Answers []DNSAnswer `json:"answers"`
+	// All the resolved addresses, from the A and AAAA answers.
+	Addrs []string `json:"addrs"`
+	// Authenticated data (AD) bit. The server validated the answers using
+	// DNSSEC.
+	Authenticated bool `json:"authenticated"`
+	// Address of the server which responded.
+	Server string `json:"server"`
+	// Transport used to get the response. Example: "udp".
+	Transport string `json:"transport"`
+	// Answers of every resolver, in compare mode. The rest of the fields
+	// are the ones of a resolver agreeing with the majority.
+	Comparison *DNSComparison `json:"comparison,omitempty"`
+}
+
+// DNSComparison is the result of resolving a domain against many resolvers.
+type DNSComparison struct {
+	// Answer of each resolver.
+	Answers []DNSResolverAnswer `json:"answers"`
+	// Resolvers which answered differently than the majority.
+	Disagreeing []string `json:"disagreeing"`
+}
+
+// DNSResolverAnswer is the answer of a resolver, in compare mode.
+type DNSResolverAnswer struct {
+	Resolver string `json:"resolver"`
+	// Response time.
+	RTT time.Duration `json:"rtt"`
+	// Response code. Example: "NXDOMAIN".
+	Rcode string `json:"rcode"`
+	// Sorted data of the answers.
+	Data []string `json:"data"`
+	// The answer is different than the one of the majority.
+	Disagree bool `json:"disagree"`
+	// The answer has no records in common with the one of the majority, but
+	// it could be valid, as for the geo-balanced domains.
+	Inconclusive bool `json:"inconclusive,omitempty"`
+	// Failure reason, the resolver did not answer.
+	Error string `json:"error,omitempty"`
+}
+
+// DNSAnswer is a record of a DNS response.
+type DNSAnswer struct {
+	Name string `json:"name"`
+	// Record type. Example: "MX".
+	Type string `json:"type"`
+	// Time to live, in seconds.
+	TTL uint32 `json:"ttl"`
+	// Record data in presentation format. Example: "10 mx.example.com.".
+	Data string `json:"data"`
+}
+
+func (r *DNSResult) summary() string {
+	summary := r.Rcode
+	if len(r.Answers) > 0 {
+		data := make([]string, 0, len(r.Answers))
+		for _, answer := range r.Answers {
+			data = append(data, answer.Data)
+		}
+		summary = strings.Join(data, ",")
+	}
+	if r.Authenticated {
+		summary = fmt.Sprintf("%s ad", summary)
+	}
+	if r.Comparison != nil {
+		summary = fmt.Sprintf(
+			"%s agree=%d/%d", summary, r.Comparison.agreeing(),
+			len(r.Comparison.Answers),
+		)
+	}
+	return summary
+}
+
+// Returns the number of resolvers agreeing with the majority.
+func (c *DNSComparison) agreeing() int {
+	count := 0
+	for _, answer := range c.Answers {
+		if answer.Error == "" && !answer.Disagree && !answer.Inconclusive {
+			count++
+		}
+	}
+	return count
+}
+
+// ICMPResult is the information gathered by the ICMP protocol.
+type ICMPResult struct {
+	// Address which sent the echo reply.
+	Addr string `json:"addr"`
+	// Sequence number of the echo request.
+	Seq int `json:"seq"`
+	// Time to live of the echo reply. The hop limit in IPv6.
+	TTL int `json:"ttl"`
+	// Size of the echo reply.
+	Size int `json:"size"`
+}
+
+// TLSResult is the information gathered by the TLS protocol.
+type TLSResult struct {
+	// Negotiated version. Example: "TLS 1.3".
+	Version string `json:"version"`
+	// Negotiated cipher suite. Example: "TLS_AES_128_GCM_SHA256".
+	CipherSuite string `json:"cipher_suite"`
+	// Negotiated application protocol. Example: "h2".
+	ALPN string `json:"alpn,omitempty"`
+	// Subject of the server certificate.
+	Subject string `json:"subject,omitempty"`
+	// Issuer of the server certificate.
+	Issuer string `json:"issuer,omitempty"`
+	// Expiration date of the server certificate.
+	NotAfter time.Time `json:"not_after,omitzero"`
+	// Reason why the server certificate is not trusted.
+	VerifyError string `json:"verify_error,omitempty"`
+}
+
+func (r *TLSResult) summary() string {
+	summary := fmt.Sprintf("%s %s", r.Version, r.CipherSuite)
+	if r.ALPN != "" {
+		summary = fmt.Sprintf("%s %s", summary, r.ALPN)
+	}
+	if !r.NotAfter.IsZero() {
+		summary = fmt.Sprintf(
+			"%s, expires %s", summary, r.NotAfter.Format(time.DateOnly),
+		)
+	}
+	return summary
+}
+
+// UDPResult is the information gathered by the UDP protocol.
+type UDPResult struct {
+	// Built-in payload sent, empty for a custom one. Example: "stun".
+	Service string `json:"service,omitempty"`
+	// Local address of the socket.
+	LocalAddr string `json:"local_addr"`
+	// Address which sent the reply.
+	RemoteAddr string `json:"remote_addr"`
+	// Size of the request.
+	BytesSent int `json:"bytes_sent"`
+	// Size of the reply.
+	BytesRead int `json:"bytes_read"`
+	// Time since the request was sent until the reply was received.
+	RTT time.Duration `json:"rtt"`
+	// The reply is the same custom payload.
+	Echo bool `json:"echo,omitempty"`
+}
+
+func (r *UDPResult) summary() string {
+	summary := fmt.Sprintf("%d bytes rtt=%s", r.BytesRead, r.RTT)
+	if r.Service != "" {
+		summary = fmt.Sprintf("%s %s", r.Service, summary)
+	}
+	if r.Echo {
+		summary += " echo"
+	}
+	return summary
+}
+
+// NTPResult is the information gathered by the NTP protocol.
+type NTPResult struct {
+	// Address of the server which replied.
+	Server string `json:"server"`
+	// Distance to the reference clock: 1 for the primary servers.
+	Stratum int `json:"stratum"`
+	// Reference identifier. Example: "GPS".
+	RefID string `json:"ref_id"`
+	// Round trip delay, without the processing time of the server.
+	RTT time.Duration `json:"rtt"`
+	// Offset of the server clock from the local one. Positive if the local
+	// clock is behind.
+	Offset time.Duration `json:"offset"`
+	// The offset is beyond the threshold.
+	Skewed bool `json:"skewed,omitempty"`
+}
+
+// HTTP3Result is the information gathered by the HTTP/3 protocol.
+type HTTP3Result struct {
+	// Status line. Example: "200 OK".
+	Status string `json:"status"`
+	// Status code. Example: 200.
+	StatusCode int `json:"status_code"`
+	// Protocol version. Example: "HTTP/3.0". The one over TCP if falling
+	// back.
+	Proto string `json:"proto"`
+	// Size of the response body.
+	BytesRead int64 `json:"bytes_read"`
+	// Negotiated QUIC version. Example: "v1". Empty if falling back.
+	QUICVersion string `json:"quic_version,omitempty"`
+	// QUIC handshake, which includes the TLS one. Zero if falling back.
+	Handshake time.Duration `json:"handshake,omitempty"`
+	// QUIC did not work but TCP did, so the browsers would fall back to it.
+	Fallback bool `json:"fallback,omitempty"`
+}
+
+func (r *HTTP3Result) summary() string {
+	if r.Fallback {
+		return fmt.Sprintf("%s fallback=%s", r.Status, r.Proto)
+	}
+	return fmt.Sprintf(
+		"%s quic=%s handshake=%s", r.Status, r.QUICVersion, r.Handshake,
+	)
+}
+
+// DualStackResult is the comparison of the same attempt over IPv4 and IPv6.
+type DualStackResult struct {
+	IPv4 *FamilyResult `json:"ipv4"`
+	IPv6 *FamilyResult `json:"ipv6"`
+	// Family a Happy Eyeballs client would use: IPv6, unless it fails or it
+	// is much slower than IPv4.
+	Preferred Family `json:"preferred"`
+}
+
+// FamilyResult is the outcome of an attempt restricted to an address family.
+type FamilyResult struct {
+	// Response time.
+	RTT time.Duration `json:"rtt"`
+	// Failure reason, empty if the attempt succeeded.
+	Error string `json:"error,omitempty"`
+	// Returned by the protocol. It can be set even if the attempt failed.
+	Result *Result `json:"result,omitempty"`
+}
+
+// Returns the result of the family.
+func (r *DualStackResult) family(f Family) *FamilyResult {
+	if f == FamilyIPv6 {
+		return r.IPv6
+	}
+	return r.IPv4
+}
+
+func (r *DualStackResult) summary() string {
+	fields := make([]string, 0, 3)
+	for _, f := range []Family{FamilyIPv4, FamilyIPv6} {
+		value := "error"
+		if res := r.family(f); res.Error == "" {
+			value = res.RTT.String()
+		}
+		fields = append(fields, fmt.Sprintf("ipv%s=%s", f, value))
+	}
+	fields = append(fields, fmt.Sprintf("preferred=ipv%s", r.Preferred))
+	return strings.Join(fields, " ")
+}
+
+// TraceResult is the information gathered by the trace protocol about a hop.
+type TraceResult struct {
+	// Number of the hop, the TTL of the probe.
+	Hop int `json:"hop"`
+	// Address of the node which answered. Empty if none did.
+	Addr string `json:"addr"`
+	// The node is the destination, so the trace is complete.
+	Reached bool `json:"reached"`
+}
+
+func (r *TraceResult) summary() string {
+	addr := r.Addr
+	if addr == "" {
+		addr = "*"
+	}
+	summary := fmt.Sprintf("hop=%d addr=%s", r.Hop, addr)
+	if r.Reached {
+		summary = fmt.Sprintf("%s reached", summary)
+	}
+	return summary
+}
+
+// ProxyComparison is the comparison of the same attempt through a proxy and
+// direct.
+type ProxyComparison struct {
+	// URL of the proxy, without the password.
+	Proxy    string      `json:"proxy"`
+	ViaProxy *PathResult `json:"via_proxy"`
+	Direct   *PathResult `json:"direct"`
+}
+
+// PathResult is the outcome of an attempt through a connection path.
+type PathResult struct {
+	// Response time.
+	RTT time.Duration `json:"rtt"`
+	// Failure reason, empty if the attempt succeeded.
+	Error string `json:"error,omitempty"`
+	// Returned by the protocol. It can be set even if the attempt failed.
+	Result *Result `json:"result,omitempty"`
+}
+
+func (r *ProxyComparison) summary() string {
+	fields := make([]string, 0, 2)
+	for _, path := range []struct {
+		name string
+		res  *PathResult
+	}{{"proxy", r.ViaProxy}, {"direct", r.Direct}} {
+		value := "error"
+		if path.res.Error == "" {
+			value = path.res.RTT.String()
+		}
+		fields = append(fields, fmt.Sprintf("%s=%s", path.name, value))
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,126 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Runner runs probes concurrently and delivers their reports.
+//
+// Every target is probed with every protocol. Probes with their own setup
+// can be added too.
+type Runner struct {
+	// Protocols to use.
+	Protocols []Protocol
+	// Optional. Where to point the probes. A random public server is used
+	// for each attempt by default.
+	Targets []string
+	// Number of iterations of each probe. Zero means infinite.
+	Count uint
+	// Delay between requests.
+	Delay time.Duration
+	// Optional. Probes with their own setup. The logger and the channel are
+	// set by the runner.
+	Probes []*Probe
+	// Optional. Maximum number of probes running at the same time. Zero means
+	// no limit.
+	Concurrency int
+	// Optional. For debugging purposes.
+	Logger *slog.Logger
+}
+
+// Returns all the probes to run.
+func (r *Runner) probes(logger *slog.Logger, reportCh chan *Report) []*Probe {
+	targets := r.Targets
+	if len(targets) == 0 {
+		targets = []string{""}
+	}
+	var probes []*Probe
+	for _, proto := range r.Protocols {
+		for _, target := range targets {
+			probes = append(probes, &Probe{
+				Proto:  proto,
+				Count:  r.Count,
+				Delay:  r.Delay,
+				Target: target,
+			})
+		}
+	}
+	for _, p := range r.Probes {
+		probe := *p
+		probes = append(probes, &probe)
+	}
+	for _, p := range probes {
+		p.Logger = logger
+		p.ReportCh = reportCh
+	}
+	return probes
+}
+
+// Reports starts the probes and returns a channel with their reports. It is
+// closed once all of them finish, or the context is cancelled.
+//
+// Returns an error if the setup is invalid.
+func (r *Runner) Reports(ctx context.Context) (<-chan *Report, error) {
+	logger := r.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	reportCh := make(chan *Report)
+	probes := r.probes(logger, reportCh)
+	if len(probes) == 0 {
+		return nil, errors.New("invalid setup: no probes")
+	}
+	for _, p := range probes {
+		err := p.validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid setup: %w", err)
+		}
+	}
+	limit := r.Concurrency
+	if limit <= 0 {
+		limit = len(probes)
+	}
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, p := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+			logger.Debug("Running ...", "setup", p)
+			// The setup is already validated.
+			_ = p.Do(ctx)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(reportCh)
+	}()
+	return reportCh, nil
+}
+
+// Run starts the probes and calls the function with each report, one at a
+// time. It blocks until all of them finish, or the context is cancelled.
+//
+// Returns an error if the setup is invalid.
+func (r *Runner) Run(ctx context.Context, fn func(*Report)) error {
+	reportCh, err := r.Reports(ctx)
+	if err != nil {
+		return err
+	}
+	for report := range reportCh {
+		fn(report)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package probe
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunnerRun(t *testing.T) {
+	t.Run("returns an error if there are no probes", func(t *testing.T) {
+		r := Runner{}
+		err := r.Run(context.Background(), func(*Report) {})
+		want := "invalid setup: no probes"
+		if err == nil || err.Error() != want {
+			t.Fatalf("got %v, want %q", err, want)
+		}
+	})
+	t.Run("returns an error if a probe is invalid", func(t *testing.T) {
+		r := Runner{Probes: []*Probe{{}}}
+		err := r.Run(context.Background(), func(*Report) {})
+		want := "invalid setup: required property: Proto"
+		if err == nil || err.Error() != want {
+			t.Fatalf("got %v, want %q", err, want)
+		}
+	})
+	t.Run("probes every target with every protocol", func(t *testing.T) {
+		r := Runner{
+			Protocols:   []Protocol{&testProtocol{}, &testProtocol{}},
+			Targets:     []string{"a", "b", "c"},
+			Count:       2,
+			Concurrency: 2,
+			Probes: []*Probe{
+				{Name: "check", Proto: &testProtocol{}, Count: 1},
+			},
+		}
+		count := 0
+		checks := 0
+		err := r.Run(context.Background(), func(report *Report) {
+			count++
+			if report.Check == "check" {
+				checks++
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 13 {
+			t.Fatalf("got %d reports, want %d", count, 13)
+		}
+		if checks != 1 {
+			t.Fatalf("got %d reports of the check, want %d", checks, 1)
+		}
+	})
+	t.Run("returns once the context is cancelled", func(t *testing.T) {
+		r := Runner{Protocols: []Protocol{&testHungProtocol{}}}
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		err := r.Run(ctx, func(*Report) {
+			t.Error("got a report, want none")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestRunnerReports(t *testing.T) {
+	r := Runner{Protocols: []Protocol{&testProtocol{}}, Count: 3}
+	reportCh, err := r.Reports(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for report := range reportCh {
+		if report.Target != testHostPort {
+			t.Fatalf("got %q, want %q", report.Target, testHostPort)
+		}
+		count++
+	}
+	if count != 3 {
+		t.Fatalf("got %d reports, want %d", count, 3)
+	}
+}
@@ -0,0 +1,447 @@
+package probe
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+const tmplRandom = "creating random number: %w"
+
+// RandomCaptivePortal returns a captive portal selected randomly from the
+// list of well-known companies.
+//
+// Returns an error if the random number generator fails.
+func RandomCaptivePortal() (*CaptivePortal, error) {
+	count := big.NewInt(int64(len(CaptivePortals)))
+	index, err := rand.Int(rand.Reader, count)
+	if err != nil {
+		return nil, fmt.Errorf(tmplRandom, err)
+	}
+	return CaptivePortals[index.Int64()], nil
+}
+
+// CaptivePortal is a URL that a well-known company uses to inspect the network
+// connections of its users, and the response it returns when there is no
+// interception.
+type CaptivePortal struct {
+	URL *url.URL
+	// Response without interception.
+	Expect Expectation
+}
+
+// CaptivePortals are the detection URLs of well-known companies.
+var CaptivePortals []*CaptivePortal = []*CaptivePortal{
+	// Google Chrome.
+	{
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   "clients3.google.com:80",
+			Path:   "/generate_204",
+		},
+		Expect: Expectation{Status: http.StatusNoContent},
+	},
+	// Mozilla Firefox.
+	{
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   "detectportal.firefox.com:80",
+			Path:   "/success.txt",
+		},
+		Expect: Expectation{Status: http.StatusOK, Body: "success"},
+	},
+	// Apple.
+	{
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   "www.apple.com:80",
+			Path:   "/library/test/success.html",
+		},
+		Expect: Expectation{Status: http.StatusOK, Body: "Success"},
+	},
+	// Microsoft.
+	{
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   "www.msftconnecttest.com:80",
+			Path:   "/connecttest.txt",
+		},
+		Expect: Expectation{
+			Status: http.StatusOK, Body: "Microsoft Connect Test",
+		},
+	},
+	// Android.
+	{
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   "connectivitycheck.android.com:80",
+			Path:   "/generate_204",
+		},
+		Expect: Expectation{Status: http.StatusNoContent},
+	},
+	// Ubuntu.
+	{
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   "connectivity-check.ubuntu.com:80",
+		},
+		Expect: Expectation{Status: http.StatusNoContent},
+	},
+	// Debian.
+	{
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   "network-test.debian.org:80",
+			Path:   "/nm",
+		},
+		Expect: Expectation{
+			Status: http.StatusOK, Body: "NetworkManager is online",
+		},
+	},
+}
+
+// RandomDNSServer returns a randomly selected public DNS server address.
+//
+// Returns an error if the random number generator fails.
+func RandomDNSServer() (string, error) {
+	count := big.NewInt(int64(len(Resolvers)))
+	index, err := rand.Int(rand.Reader, count)
+	if err != nil {
+		return "", fmt.Errorf(tmplRandom, err)
+	}
+	return Resolvers[index.Int64()].String(), nil
+}
+
+// RandomDNSServerIPv6 returns a randomly selected public DNS server IPv6
+// address.
+//
+// Returns an error if the random number generator fails.
+func RandomDNSServerIPv6() (string, error) {
+	count := big.NewInt(int64(len(ResolversIPv6)))
+	index, err := rand.Int(rand.Reader, count)
+	if err != nil {
+		return "", fmt.Errorf(tmplRandom, err)
+	}
+	return ResolversIPv6[index.Int64()].String(), nil
+}
+
+// Returns a public DNS server address of the family, IPv4 if any.
+func randomDNSServer(f Family) (string, error) {
+	if f == FamilyIPv6 {
+		return RandomDNSServerIPv6()
+	}
+	return RandomDNSServer()
+}
+
+// Returns the IPv4 and IPv6 addresses of a public DNS server selected
+// randomly.
+func randomDNSServers() (string, string, error) {
+	count := big.NewInt(int64(len(ResolversIPv6)))
+	index, err := rand.Int(rand.Reader, count)
+	if err != nil {
+		return "", "", fmt.Errorf(tmplRandom, err)
+	}
+	i := index.Int64()
+	return Resolvers[i].String(), ResolversIPv6[i].String(), nil
+}
+
+// Returns the public DNS servers of the family, IPv4 if any.
+func familyResolvers(f Family) []*net.IP {
+	if f == FamilyIPv6 {
+		return ResolversIPv6
+	}
+	return Resolvers
+}
+
+// Resolvers is a list of public DNS server IPv4 addresses.
+var Resolvers = []*net.IP{
+	// Cloudflare
+	{1, 1, 1, 1},
+	{1, 0, 0, 1},
+	// Google
+	{8, 8, 8, 8},
+	{8, 8, 4, 4},
+	// OpenDNS
+	{208, 67, 222, 222},
+	{208, 67, 222, 220},
+	// Control D
+	{76, 76, 2, 0},
+	{76, 76, 10, 0},
+	// AdGuard
+	{94, 140, 14, 14},
+	{94, 140, 15, 15},
+	// CleanBrowsing
+	{185, 228, 168, 9},
+	{185, 228, 169, 9},
+	// Verisign
+	{64, 6, 64, 6},
+	{64, 6, 65, 6},
+	// Quad9
+	{9, 9, 9, 9},
+	{149, 112, 112, 112},
+	// Neustar
+	{156, 154, 70, 1},
+	{156, 154, 71, 1},
+	// Yandex
+	{77, 88, 8, 8},
+	{77, 88, 8, 1},
+	// SafeDNS
+	{195, 46, 39, 39},
+	{195, 46, 39, 40},
+	// Norton ConnectSafe
+	{199, 85, 126, 10},
+	{199, 85, 127, 10},
+}
+
+// ResolversIPv6 is a list of public DNS server IPv6 addresses, of the same
+// providers as Resolvers and in the same order.
+var ResolversIPv6 = []*net.IP{
+	// Cloudflare
+	parseIP("2606:4700:4700::1111"),
+	parseIP("2606:4700:4700::1001"),
+	// Google
+	parseIP("2001:4860:4860::8888"),
+	parseIP("2001:4860:4860::8844"),
+	// OpenDNS
+	parseIP("2620:119:35::35"),
+	parseIP("2620:119:53::53"),
+	// Control D
+	parseIP("2606:1a40::"),
+	parseIP("2606:1a40:1::"),
+	// AdGuard
+	parseIP("2a10:50c0::ad1:ff"),
+	parseIP("2a10:50c0::ad2:ff"),
+	// CleanBrowsing
+	parseIP("2a0d:2a00:1::2"),
+	parseIP("2a0d:2a00:2::2"),
+	// Verisign
+	parseIP("2620:74:1b::1:1"),
+	parseIP("2620:74:1c::2:2"),
+	// Quad9
+	parseIP("2620:fe::fe"),
+	parseIP("2620:fe::9"),
+	// Neustar
+	parseIP("2610:a1:1018::1"),
+	parseIP("2610:a1:1019::1"),
+	// Yandex
+	parseIP("2a02:6b8::feed:ff"),
+	parseIP("2a02:6b8:0:1::feed:ff"),
+	// SafeDNS
+	parseIP("2001:67c:2778::3939"),
+	parseIP("2001:67c:2778::3940"),
+	// Norton ConnectSafe does not have IPv6 servers.
+}
+
+// Returns the IP address in the string, which must be valid.
+func parseIP(s string) *net.IP {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		panic("probe: invalid IP address: " + s)
+	}
+	return &ip
+}
+
+// RandomDoHServer returns a DNS-over-HTTPS endpoint selected randomly from the
+// public ones.
+//
+// Returns an error if the random number generator fails.
+func RandomDoHServer() (string, error) {
+	count := big.NewInt(int64(len(DoHServers)))
+	index, err := rand.Int(rand.Reader, count)
+	if err != nil {
+		return "", fmt.Errorf(tmplRandom, err)
+	}
+	return DoHServers[index.Int64()], nil
+}
+
+// DoHServers is a list of public DNS-over-HTTPS endpoints.
+var DoHServers = []string{
+	// Cloudflare
+	"https://cloudflare-dns.com/dns-query",
+	// Google
+	"https://dns.google/dns-query",
+	// Quad9
+	"https://dns.quad9.net/dns-query",
+	// OpenDNS
+	"https://doh.opendns.com/dns-query",
+	// AdGuard
+	"https://dns.adguard-dns.com/dns-query",
+	// Control D
+	"https://freedns.controld.com/p0",
+}
+
+// RandomDoTServer returns a DNS-over-TLS host:port selected randomly from the
+// public ones.
+//
+// Returns an error if the random number generator fails.
+func RandomDoTServer() (string, error) {
+	count := big.NewInt(int64(len(DoTServers)))
+	index, err := rand.Int(rand.Reader, count)
+	if err != nil {
+		return "", fmt.Errorf(tmplRandom, err)
+	}
+	return DoTServers[index.Int64()], nil
+}
+
+// DoTServers is a list of public DNS-over-TLS servers host:port.
+var DoTServers = []string{
+	// Cloudflare
+	"one.one.one.one:853",
+	// Google
+	"dns.google:853",
+	// Quad9
+	"dns.quad9.net:853",
+	// AdGuard
+	"dns.adguard-dns.com:853",
+	// Control D
+	"p0.freedns.controld.com:853",
+}
+
+// RandomTCPServer returns a TCP host:port selected randomly from the public DNS
+// servers.
+//
+// Returns an error if the random number generator fails.
+func RandomTCPServer() (string, error) {
+	serverAddr, err := RandomDNSServer()
+	if err != nil {
+		return "", fmt.Errorf(tmplRandom, err)
+	}
+	return net.JoinHostPort(serverAddr, "53"), nil
+}
+
+// Returns a TCP host:port of a public DNS server of the family, IPv4 if any.
+func randomTCPServer(f Family) (string, error) {
+	serverAddr, err := randomDNSServer(f)
+	if err != nil {
+		return "", fmt.Errorf(tmplRandom, err)
+	}
+	return net.JoinHostPort(serverAddr, "53"), nil
+}
+
+// RandomTLSServer returns a host:port selected randomly from the well-known
+// HTTPS servers.
+//
+// Returns an error if the random number generator fails.
+func RandomTLSServer() (string, error) {
+	count := big.NewInt(int64(len(TLSServers)))
+	index, err := rand.Int(rand.Reader, count)
+	if err != nil {
+		return "", fmt.Errorf(tmplRandom, err)
+	}
+	return TLSServers[index.Int64()], nil
+}
+
+// TLSServers is a list of well-known HTTPS servers host:port.
+var TLSServers = []string{
+	// Google.
+	"www.google.com:443",
+	// Cloudflare.
+	"www.cloudflare.com:443",
+	// Mozilla.
+	"www.mozilla.org:443",
+	// Apple.
+	"www.apple.com:443",
+	// Microsoft.
+	"www.microsoft.com:443",
+	// Wikipedia.
+	"www.wikipedia.org:443",
+	// GitHub.
+	"github.com:443",
+}
+
+// RandomSTUNServer returns a host:port selected randomly from the public STUN
+// servers.
+//
+// Returns an error if the random number generator fails.
+func RandomSTUNServer() (string, error) {
+	count := big.NewInt(int64(len(STUNServers)))
+	index, err := rand.Int(rand.Reader, count)
+	if err != nil {
+		return "", fmt.Errorf(tmplRandom, err)
+	}
+	return STUNServers[index.Int64()], nil
+}
+
+// STUNServers is a list of public STUN servers host:port, used by VoIP and
+// WebRTC clients to discover their public address.
+var STUNServers = []string{
+	// Google.
+	"stun.l.google.com:19302",
+	"stun1.l.google.com:19302",
+	// Cloudflare.
+	"stun.cloudflare.com:3478",
+	// Twilio.
+	"global.stun.twilio.com:3478",
+}
+
+// RandomNTPServer returns a host selected randomly from the public NTP
+// servers.
+//
+// Returns an error if the random number generator fails.
+func RandomNTPServer() (string, error) {
+	count := big.NewInt(int64(len(NTPServers)))
+	index, err := rand.Int(rand.Reader, count)
+	if err != nil {
+		return "", fmt.Errorf(tmplRandom, err)
+	}
+	return NTPServers[index.Int64()], nil
+}
+
+// NTPServers is a list of public NTP servers: the ones of the NTP Pool
+// Project and well-known companies.
+var NTPServers = []string{
+	// NTP Pool Project.
+	"0.pool.ntp.org",
+	"1.pool.ntp.org",
+	"2.pool.ntp.org",
+	"3.pool.ntp.org",
+	// Google.
+	"time.google.com",
+	// Cloudflare.
+	"time.cloudflare.com",
+	// Apple.
+	"time.apple.com",
+	// Microsoft.
+	"time.windows.com",
+}
+
+// RandomHTTP3Server returns a URL selected randomly from the well-known
+// HTTP/3 servers.
+//
+// Returns an error if the random number generator fails.
+func RandomHTTP3Server() (string, error) {
+	count := big.NewInt(int64(len(HTTP3Servers)))
+	index, err := rand.Int(rand.Reader, count)
+	if err != nil {
+		return "", fmt.Errorf(tmplRandom, err)
+	}
+	return HTTP3Servers[index.Int64()], nil
+}
+
+// HTTP3Servers is a list of well-known HTTPS servers URLs supporting HTTP/3.
+var HTTP3Servers = []string{
+	// Google.
+	"https://www.google.com/",
+	// Cloudflare.
+	"https://cloudflare-quic.com/",
+	// Meta.
+	"https://www.facebook.com/",
+	// Fastly.
+	"https://www.fastly.com/",
+	// NGINX.
+	"https://quic.nginx.org/",
+}
+
+// RandomDomain returns a domain selected randomly from the captive portals.
+//
+// Returns an error if the random number generator fails.
+func RandomDomain() (string, error) {
+	portal, err := RandomCaptivePortal()
+	if err != nil {
+		return "", fmt.Errorf(tmplRandom, err)
+	}
+	return portal.URL.Hostname(), nil
+}
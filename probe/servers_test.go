@@ -0,0 +1,109 @@
+package probe
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestRandomCaptivePortal(t *testing.T) {
+	got, err := RandomCaptivePortal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = url.Parse(got.URL.String())
+	if err != nil {
+		t.Fatalf("invalid URL: %s", got.URL)
+	}
+	if got.Expect.Status == 0 {
+		t.Fatalf("missing expected status: %s", got.URL)
+	}
+}
+
+func TestRandomDNSServer(t *testing.T) {
+	got, err := RandomDNSServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := net.ParseIP(got)
+	if ip == nil {
+		t.Fatalf("invalid IP: %s", got)
+	}
+}
+
+func TestRandomDNSServerIPv6(t *testing.T) {
+	got, err := RandomDNSServerIPv6()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := net.ParseIP(got)
+	if ip == nil || ip.To4() != nil {
+		t.Fatalf("invalid IPv6: %s", got)
+	}
+}
+
+func TestRandomTCPServer(t *testing.T) {
+	got, err := RandomTCPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, err := net.SplitHostPort(got)
+	if err != nil {
+		t.Fatalf("invalid host/port: %s", got)
+	}
+	if port != "53" {
+		t.Fatalf("invalid port: %s", port)
+	}
+}
+
+func TestRandomDoHServer(t *testing.T) {
+	got, err := RandomDoHServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(got)
+	if err != nil || u.Scheme != "https" {
+		t.Fatalf("invalid URL: %s", got)
+	}
+}
+
+func TestRandomDoTServer(t *testing.T) {
+	got, err := RandomDoTServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, err := net.SplitHostPort(got)
+	if err != nil {
+		t.Fatalf("invalid host/port: %s", got)
+	}
+	if port != "853" {
+		t.Fatalf("invalid port: %s", port)
+	}
+}
+
+func TestRandomDomain(t *testing.T) {
+	got, err := RandomDomain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := fmt.Sprintf("http://%s", got)
+	_, err = url.Parse(u)
+	if err != nil {
+		t.Fatalf("invalid domain: %s", got)
+	}
+}
+
+func TestRandomTLSServer(t *testing.T) {
+	got, err := RandomTLSServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, err := net.SplitHostPort(got)
+	if err != nil {
+		t.Fatalf("invalid host/port: %s", got)
+	}
+	if port != "443" {
+		t.Fatalf("invalid port: %s", port)
+	}
+}
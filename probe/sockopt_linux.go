@@ -0,0 +1,12 @@
+//go:build linux
+
+package probe
+
+import "syscall"
+
+// Binds a socket to a network interface, so its packets only go through it.
+func bindToDevice(fd uintptr, iface string) error {
+	return syscall.SetsockoptString(
+		int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface,
+	)
+}
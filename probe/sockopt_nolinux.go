@@ -0,0 +1,10 @@
+//go:build !linux
+
+package probe
+
+import "errors"
+
+// Binds a socket to a network interface, so its packets only go through it.
+func bindToDevice(fd uintptr, iface string) error {
+	return errors.ErrUnsupported
+}
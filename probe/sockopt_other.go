@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package probe
+
+import "errors"
+
+// Sets the TTL (hop limit in IPv6) of the packets sent by a socket.
+func setTTL(fd uintptr, v6 bool, ttl int) error {
+	return errors.ErrUnsupported
+}
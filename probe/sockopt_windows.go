@@ -0,0 +1,18 @@
+//go:build windows
+
+package probe
+
+import "syscall"
+
+// Sets the TTL (hop limit in IPv6) of the packets sent by a socket.
+func setTTL(fd uintptr, v6 bool, ttl int) error {
+	if v6 {
+		return syscall.SetsockoptInt(
+			syscall.Handle(fd), syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS,
+			ttl,
+		)
+	}
+	return syscall.SetsockoptInt(
+		syscall.Handle(fd), syscall.IPPROTO_IP, syscall.IP_TTL, ttl,
+	)
+}
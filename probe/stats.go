@@ -0,0 +1,388 @@
+package probe
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Target used in the summaries aggregating all the targets of a protocol.
+const allTargets = "*"
+
+// Response times kept by each group to calculate the percentiles. Beyond it,
+// a uniform sample of them is kept, so the memory used is bounded in the runs
+// without end.
+const statsSampleSize = 1024
+
+// Stats aggregates the reports of a run, like the ping utility does. The
+// memory used does not grow with the number of reports.
+//
+// The zero value is ready to use. It is not safe for concurrent use.
+type Stats struct {
+	// Groups in order of appearance.
+	groups []*statsGroup
+}
+
+// Reports of the same check, interface, protocol and target.
+type statsGroup struct {
+	check      string
+	iface      string
+	protocolID string
+	target     string
+	sent       int
+	// Response times of the successful attempts.
+	times timeStats
+}
+
+// Aggregation of response times, using bounded memory.
+type timeStats struct {
+	count int
+	min   time.Duration
+	max   time.Duration
+	// Running mean and sum of the squared differences from it (Welford's
+	// algorithm).
+	mean float64
+	m2   float64
+	// Uniform sample of the times (reservoir sampling).
+	sample []time.Duration
+}
+
+// Includes a new response time.
+func (ts *timeStats) add(d time.Duration) {
+	ts.count++
+	if ts.count == 1 || d < ts.min {
+		ts.min = d
+	}
+	ts.max = max(ts.max, d)
+	delta := float64(d) - ts.mean
+	ts.mean += delta / float64(ts.count)
+	ts.m2 += delta * (float64(d) - ts.mean)
+	if len(ts.sample) < statsSampleSize {
+		ts.sample = append(ts.sample, d)
+		return
+	}
+	if i := rand.IntN(ts.count); i < statsSampleSize {
+		ts.sample[i] = d
+	}
+}
+
+// Includes the aggregation of other times, except the sample.
+func (ts *timeStats) merge(o *timeStats) {
+	switch {
+	case o.count == 0:
+		return
+	case ts.count == 0:
+		ts.count, ts.min, ts.max, ts.mean, ts.m2 = o.count, o.min, o.max,
+			o.mean, o.m2
+		return
+	}
+	n := float64(ts.count + o.count)
+	delta := o.mean - ts.mean
+	ts.mean += delta * float64(o.count) / n
+	ts.m2 += o.m2 + delta*delta*float64(ts.count)*float64(o.count)/n
+	ts.count += o.count
+	ts.min = min(ts.min, o.min)
+	ts.max = max(ts.max, o.max)
+}
+
+// Add includes a new report in the statistics.
+//
+// The reports of the probes without target are grouped together, as each
+// attempt can use a different public server.
+func (s *Stats) Add(r *Report) {
+	target := r.groupTarget()
+	var group *statsGroup
+	for _, g := range s.groups {
+		if g.check == r.Check && g.iface == r.Interface &&
+			g.protocolID == r.ProtocolID && g.target == target {
+			group = g
+			break
+		}
+	}
+	if group == nil {
+		group = &statsGroup{
+			check: r.Check, iface: r.Interface, protocolID: r.ProtocolID,
+			target: target,
+		}
+		s.groups = append(s.groups, group)
+	}
+	group.sent++
+	if r.Succeeded() {
+		group.times.add(r.Time)
+	}
+}
+
+// Summary is the result of aggregating the reports of a protocol and target.
+type Summary struct {
+	// Name of the check, if any.
+	Check string `json:"check,omitempty"`
+	// Network interface used, if bound to one.
+	Interface string `json:"interface,omitempty"`
+	// Protocol used to connect to.
+	ProtocolID string `json:"protocol"`
+	// Target used to connect to. "*" for the aggregation of all the targets
+	// of a protocol, and "random" for the public servers chosen by it.
+	Target string `json:"target"`
+	// Number of attempts.
+	Sent int `json:"sent"`
+	// Number of successful attempts.
+	Received int `json:"received"`
+	// Percentage of failed attempts.
+	Loss float64 `json:"loss"`
+	// Response times of the successful attempts. The percentiles are
+	// estimated from a sample in long runs.
+	Min  time.Duration `json:"min"`
+	Avg  time.Duration `json:"avg"`
+	Max  time.Duration `json:"max"`
+	Mdev time.Duration `json:"mdev"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P99  time.Duration `json:"p99"`
+}
+
+// Summaries returns the aggregation of the reports for each check, interface,
+// protocol and target, in order of appearance.
+//
+// Protocols used with more than one target also include the aggregation of
+// all of them.
+func (s *Stats) Summaries() []*Summary {
+	type protocolKey struct{ check, iface, protocolID string }
+	var keys []protocolKey
+	byProtocol := map[protocolKey][]*statsGroup{}
+	for _, g := range s.groups {
+		key := protocolKey{g.check, g.iface, g.protocolID}
+		if _, ok := byProtocol[key]; !ok {
+			keys = append(keys, key)
+		}
+		byProtocol[key] = append(byProtocol[key], g)
+	}
+	var summaries []*Summary
+	for _, key := range keys {
+		groups := byProtocol[key]
+		for _, g := range groups {
+			summaries = append(summaries, newSummary(
+				key.check, key.iface, key.protocolID, g.target, g.sent, &g.times,
+			))
+		}
+		if len(groups) < 2 {
+			continue
+		}
+		sent := 0
+		parts := make([]*timeStats, 0, len(groups))
+		for _, g := range groups {
+			sent += g.sent
+			parts = append(parts, &g.times)
+		}
+		summaries = append(summaries, newSummary(
+			key.check, key.iface, key.protocolID, allTargets, sent, parts...,
+		))
+	}
+	return summaries
+}
+
+// Returns the summary of the attempts, with the response times aggregated
+// from all the parts.
+func newSummary(
+	check, iface, protocolID, target string, sent int, parts ...*timeStats,
+) *Summary {
+	var times timeStats
+	for _, p := range parts {
+		times.merge(p)
+	}
+	s := &Summary{
+		Check:      check,
+		Interface:  iface,
+		ProtocolID: protocolID,
+		Target:     target,
+		Sent:       sent,
+		Received:   times.count,
+	}
+	if sent > 0 {
+		s.Loss = 100 * float64(sent-times.count) / float64(sent)
+	}
+	if times.count == 0 {
+		return s
+	}
+	s.Min = times.min
+	s.Max = times.max
+	s.Avg = time.Duration(times.mean)
+	s.Mdev = time.Duration(math.Sqrt(times.m2 / float64(times.count)))
+	sorted := sortedSample(parts)
+	s.P50 = percentile(sorted, 50)
+	s.P90 = percentile(sorted, 90)
+	s.P99 = percentile(sorted, 99)
+	return s
+}
+
+// A response time of a sample, standing for a number of attempts.
+type sampledTime struct {
+	time   time.Duration
+	weight float64
+}
+
+// Returns the samples of the parts, sorted by time. Each time stands for as
+// many attempts as the part has per sampled time.
+func sortedSample(parts []*timeStats) []sampledTime {
+	var sorted []sampledTime
+	for _, p := range parts {
+		if len(p.sample) == 0 {
+			continue
+		}
+		weight := float64(p.count) / float64(len(p.sample))
+		for _, t := range p.sample {
+			sorted = append(sorted, sampledTime{t, weight})
+		}
+	}
+	slices.SortFunc(sorted, func(a, b sampledTime) int {
+		return cmp.Compare(a.time, b.time)
+	})
+	return sorted
+}
+
+// Returns the nearest-rank percentile of a sorted sample.
+func percentile(sorted []sampledTime, p float64) time.Duration {
+	var total float64
+	for _, s := range sorted {
+		total += s.weight
+	}
+	rank := p / 100 * total
+	var acc float64
+	for _, s := range sorted {
+		acc += s.weight
+		if acc >= rank {
+			return s.time
+		}
+	}
+	return sorted[len(sorted)-1].time
+}
+
+// String returns the summaries ready to be printed.
+func (s *Stats) String(format Format) (string, error) {
+	summaries := s.Summaries()
+	switch format {
+	case HumanFormat:
+		return summariesHuman(summaries), nil
+	case JSONFormat:
+		out, err := summariesJSON(summaries)
+		if err != nil {
+			return "", fmt.Errorf("error generating JSON summary: %w", err)
+		}
+		return out, nil
+	case GrepFormat:
+		return summariesGrep(summaries), nil
+	default:
+		return "", fmt.Errorf("unsupported format: %v", format)
+	}
+}
+
+// Returns the summaries in JSON format, as a single object.
+// Example:
+// '{"summary":[{"protocol":"tcp","target":"1.1.1.1:53","sent":2,"received":2,"loss":0,"min":13433165,...}]}'
+func summariesJSON(summaries []*Summary) (string, error) {
+	out, err := json.Marshal(struct {
+		Summary []*Summary `json:"summary"`
+	}{summaries})
+	if err != nil {
+		return "", fmt.Errorf("marshaling summary: %w", err)
+	}
+	return string(out), nil
+}
+
+// Returns the summaries in human readable format, as a table.
+// Example:
+// --- statistics ---
+// PROTOCOL  TARGET      SENT  RECEIVED  LOSS  MIN     AVG     MAX     MDEV   P50     P90     P99
+// tcp       1.1.1.1:53  2     2         0%    10ms    11ms    12ms    1ms    10ms    12ms    12ms
+//
+// The name of the check is included as the first column, if any, and the
+// interface follows the protocol. Example: 'tcp@eth0'.
+func summariesHuman(summaries []*Summary) string {
+	withChecks := slices.ContainsFunc(summaries, func(s *Summary) bool {
+		return s.Check != ""
+	})
+	var buf bytes.Buffer
+	buf.WriteString(bold("--- statistics ---") + "\n")
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	if withChecks {
+		fmt.Fprint(w, "CHECK\t")
+	}
+	fmt.Fprintln(
+		w, "PROTOCOL\tTARGET\tSENT\tRECEIVED\tLOSS\tMIN\tAVG\tMAX\tMDEV\tP50\tP90\tP99",
+	)
+	for _, s := range summaries {
+		if withChecks {
+			fmt.Fprintf(w, "%s\t", s.Check)
+		}
+		fmt.Fprintf(
+			w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			withInterface(s.ProtocolID, s.Interface), s.Target, s.Sent,
+			s.Received, formatLoss(s.Loss), s.Min, s.Avg, s.Max, s.Mdev, s.P50,
+			s.P90, s.P99,
+		)
+	}
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Returns the summaries in a grepable format, one line for each.
+//
+// Example: 'summary	tcp	1.1.1.1:53	2	2	0%	10ms	11ms	12ms	1ms	10ms	12ms	12ms'
+// The interface and the check are appended, if any. Example: 'check=portal'.
+func summariesGrep(summaries []*Summary) string {
+	lines := make([]string, 0, len(summaries))
+	for _, s := range summaries {
+		line := fmt.Sprintf(
+			"summary\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s",
+			s.ProtocolID, s.Target, s.Sent, s.Received, formatLoss(s.Loss),
+			s.Min, s.Avg, s.Max, s.Mdev, s.P50, s.P90, s.P99,
+		)
+		lines = append(lines, withLabels(line, s.Interface, s.Check))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatLoss(loss float64) string {
+	return fmt.Sprintf("%s%%", strings.TrimSuffix(
+		strings.TrimRight(fmt.Sprintf("%.1f", loss), "0"), ".",
+	))
+}
+
+// Succeeded returns true if the run meets the requirements.
+//
+// By default, at least one response has to be received. A non zero ratio is
+// the minimum fraction (0-1) of successful attempts. If all is true, the
+// requirements apply to every protocol and target instead of to the whole run.
+func (s *Stats) Succeeded(all bool, ratio float64) bool {
+	if len(s.groups) == 0 {
+		return false
+	}
+	if all {
+		for _, g := range s.groups {
+			if !meets(g.sent, g.times.count, ratio) {
+				return false
+			}
+		}
+		return true
+	}
+	sent, received := 0, 0
+	for _, g := range s.groups {
+		sent += g.sent
+		received += g.times.count
+	}
+	return meets(sent, received, ratio)
+}
+
+// Returns true if there is a response and the success ratio is reached.
+func meets(sent, received int, ratio float64) bool {
+	if received == 0 {
+		return false
+	}
+	return float64(received)/float64(sent) >= ratio
+}
@@ -0,0 +1,247 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestStats() *Stats {
+	var s Stats
+	for _, r := range []*Report{
+		{ProtocolID: "tcp", Target: "127.0.0.1:80", Time: 10},
+		{ProtocolID: "tcp", Target: "127.0.0.1:80", Time: 30},
+		{ProtocolID: "tcp", Target: "127.0.0.1:80", Time: 20},
+		{ProtocolID: "tcp", Target: "127.0.0.1:80", Time: 5, Error: "error-0"},
+		{ProtocolID: "dns", Target: "example.com", Time: 5, Error: "error-0"},
+		{ProtocolID: "tcp", Target: "127.0.0.1:81", Time: 40},
+	} {
+		s.Add(r)
+	}
+	return &s
+}
+
+func TestStatsSummaries(t *testing.T) {
+	got := newTestStats().Summaries()
+	if len(got) != 4 {
+		t.Fatalf("got %d summaries, want %d", len(got), 4)
+	}
+	t.Run("aggregates the reports of a target", func(t *testing.T) {
+		want := Summary{
+			ProtocolID: "tcp",
+			Target:     "127.0.0.1:80",
+			Sent:       4,
+			Received:   3,
+			Loss:       25,
+			Min:        10,
+			Avg:        20,
+			Max:        30,
+			Mdev:       time.Duration(8),
+			P50:        20,
+			P90:        30,
+			P99:        30,
+		}
+		if *got[0] != want {
+			t.Fatalf("got %+v, want %+v", *got[0], want)
+		}
+	})
+	t.Run("aggregates all the targets of a protocol", func(t *testing.T) {
+		want := Summary{
+			ProtocolID: "tcp",
+			Target:     "*",
+			Sent:       5,
+			Received:   4,
+			Loss:       20,
+			Min:        10,
+			Avg:        25,
+			Max:        40,
+			Mdev:       time.Duration(11),
+			P50:        20,
+			P90:        40,
+			P99:        40,
+		}
+		if *got[2] != want {
+			t.Fatalf("got %+v, want %+v", *got[2], want)
+		}
+	})
+	t.Run("skips latencies if nothing was received", func(t *testing.T) {
+		want := Summary{
+			ProtocolID: "dns", Target: "example.com", Sent: 1, Loss: 100,
+		}
+		if *got[3] != want {
+			t.Fatalf("got %+v, want %+v", *got[3], want)
+		}
+	})
+}
+
+func TestStatsSummariesInterface(t *testing.T) {
+	var s Stats
+	for _, iface := range []string{"eth0", "wlan0", "eth0"} {
+		s.Add(&Report{
+			Interface: iface, ProtocolID: "tcp", Target: "127.0.0.1:80", Time: 10,
+		})
+	}
+	t.Run("aggregates each interface apart", func(t *testing.T) {
+		got := s.Summaries()
+		if len(got) != 2 {
+			t.Fatalf("got %d summaries, want %d", len(got), 2)
+		}
+		if got[0].Interface != "eth0" || got[0].Sent != 2 {
+			t.Fatalf("got %+v, want 2 attempts through eth0", *got[0])
+		}
+		if got[1].Interface != "wlan0" || got[1].Sent != 1 {
+			t.Fatalf("got %+v, want 1 attempt through wlan0", *got[1])
+		}
+	})
+}
+
+func TestStatsSummariesRandom(t *testing.T) {
+	var s Stats
+	for _, r := range []*Report{
+		{ProtocolID: "tcp", Target: "1.1.1.1:53", RandomTarget: true, Time: 10},
+		{ProtocolID: "tcp", RandomTarget: true, Error: "timeout"},
+		{ProtocolID: "tcp", Target: "8.8.8.8:53", RandomTarget: true, Time: 20},
+	} {
+		s.Add(r)
+	}
+	t.Run("aggregates the random targets together", func(t *testing.T) {
+		got := s.Summaries()
+		if len(got) != 1 {
+			t.Fatalf("got %d summaries, want %d", len(got), 1)
+		}
+		if got[0].Target != "random" || got[0].Sent != 3 ||
+			got[0].Received != 2 {
+			t.Fatalf("got %+v, want 2/3 random attempts", *got[0])
+		}
+	})
+}
+
+func TestStatsSummariesWarning(t *testing.T) {
+	var s Stats
+	s.Add(&Report{
+		ProtocolID: "ntp", Target: "127.0.0.1:123", Time: 10,
+		Error:  "clock offset beyond the threshold: 1h0m0s",
+		Result: &Result{NTP: &NTPResult{Skewed: true}},
+	})
+	t.Run("counts the warnings as received", func(t *testing.T) {
+		got := s.Summaries()[0]
+		if got.Received != 1 || got.Loss != 0 {
+			t.Fatalf("got %+v, want 1 received", *got)
+		}
+		if !s.Succeeded(true, 1) {
+			t.Fatal("got false, want true")
+		}
+	})
+}
+
+func TestStatsSummariesLong(t *testing.T) {
+	var s Stats
+	n := 10 * statsSampleSize
+	for i := range n {
+		s.Add(&Report{
+			ProtocolID: "tcp", Target: "127.0.0.1:80",
+			Time: time.Duration(i + 1),
+		})
+	}
+	t.Run("keeps a bounded sample of the times", func(t *testing.T) {
+		if got := len(s.groups[0].times.sample); got != statsSampleSize {
+			t.Fatalf("got %d times, want %d", got, statsSampleSize)
+		}
+	})
+	t.Run("aggregates all the times", func(t *testing.T) {
+		got := s.Summaries()[0]
+		if got.Received != n || got.Min != 1 || got.Max != time.Duration(n) {
+			t.Fatalf("got %+v, want %d attempts from 1 to %d", *got, n, n)
+		}
+		if got.Avg != time.Duration(n+1)/2 {
+			t.Fatalf("got %s, want %s", got.Avg, time.Duration(n+1)/2)
+		}
+		// Estimated from the sample.
+		if got.P50 < time.Duration(n)*4/10 || got.P50 > time.Duration(n)*6/10 {
+			t.Fatalf("got %s, want around %s", got.P50, time.Duration(n)/2)
+		}
+	})
+}
+
+func TestStatsString(t *testing.T) {
+	var s Stats
+	s.Add(&Report{ProtocolID: "tcp", Target: "127.0.0.1:80", Time: 1})
+	s.Add(&Report{ProtocolID: "tcp", Target: "127.0.0.1:80", Error: "error-0"})
+	t.Run("returns the summary using human format", func(t *testing.T) {
+		got, err := s.String(HumanFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "--- statistics ---\n" +
+			"PROTOCOL  TARGET        SENT  RECEIVED  LOSS  MIN  AVG  MAX  MDEV  P50  P90  P99\n" +
+			"tcp       127.0.0.1:80  2     1         50%   1ns  1ns  1ns  0s    1ns  1ns  1ns"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("returns the summary using JSON format", func(t *testing.T) {
+		got, err := s.String(JSONFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"summary":[{"protocol":"tcp","target":"127.0.0.1:80","sent":2,"received":1,"loss":50,"min":1,"avg":1,"max":1,"mdev":0,"p50":1,"p90":1,"p99":1}]}`
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("returns the summary using a grepable format", func(t *testing.T) {
+		got, err := s.String(GrepFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "summary\ttcp\t127.0.0.1:80\t2\t1\t50%\t1ns\t1ns\t1ns\t0s\t1ns\t1ns\t1ns"
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestStatsSucceeded(t *testing.T) {
+	s := newTestStats()
+	t.Run("returns true if any response was received", func(t *testing.T) {
+		if !s.Succeeded(false, 0) {
+			t.Fatal("got false, want true")
+		}
+	})
+	t.Run("returns false if no response was received", func(t *testing.T) {
+		var s Stats
+		s.Add(&Report{ProtocolID: "tcp", Error: "error-0"})
+		if s.Succeeded(false, 0) {
+			t.Fatal("got true, want false")
+		}
+	})
+	t.Run("returns false if nothing was sent", func(t *testing.T) {
+		var s Stats
+		if s.Succeeded(false, 0) {
+			t.Fatal("got true, want false")
+		}
+	})
+	t.Run("checks the success ratio of the whole run", func(t *testing.T) {
+		// 4 of 6 attempts.
+		if !s.Succeeded(false, 0.6) {
+			t.Fatal("got false, want true")
+		}
+		if s.Succeeded(false, 0.7) {
+			t.Fatal("got true, want false")
+		}
+	})
+	t.Run("checks every protocol and target if required", func(t *testing.T) {
+		if s.Succeeded(true, 0) {
+			t.Fatal("got true, want false")
+		}
+		var s Stats
+		s.Add(&Report{ProtocolID: "tcp", Target: "127.0.0.1:80"})
+		s.Add(&Report{ProtocolID: "tcp", Target: "127.0.0.1:80", Error: "error-0"})
+		s.Add(&Report{ProtocolID: "dns", Target: "example.com"})
+		if !s.Succeeded(true, 0.5) {
+			t.Fatal("got false, want true")
+		}
+		if s.Succeeded(true, 0.6) {
+			t.Fatal("got true, want false")
+		}
+	})
+}
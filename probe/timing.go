@@ -0,0 +1,106 @@
+package probe
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing is the duration of each phase of a connection attempt.
+//
+// Phases which did not happen are zero. For example, the TLS handshake in
+// plain HTTP requests.
+type Timing struct {
+	// Name resolution.
+	DNS time.Duration `json:"dns"`
+	// TCP handshake.
+	Connect time.Duration `json:"connect"`
+	// TLS handshake.
+	TLS time.Duration `json:"tls"`
+	// Time to first byte, since the request was sent.
+	TTFB time.Duration `json:"ttfb"`
+	// Whole attempt, including the response reading.
+	Total time.Duration `json:"total"`
+}
+
+// Returns the phases as a list of key/value pairs.
+func (t *Timing) fields() []string {
+	return []string{
+		fmt.Sprintf("dns=%s", t.DNS),
+		fmt.Sprintf("connect=%s", t.Connect),
+		fmt.Sprintf("tls=%s", t.TLS),
+		fmt.Sprintf("ttfb=%s", t.TTFB),
+		fmt.Sprintf("total=%s", t.Total),
+	}
+}
+
+// Records the phases of an HTTP request.
+type timingTrace struct {
+	mu        sync.Mutex
+	start     time.Time
+	dnsStart  time.Time
+	connStart time.Time
+	tlsStart  time.Time
+	wrote     time.Time
+	timing    Timing
+}
+
+// Starts recording the phases of a new HTTP request.
+func newTimingTrace() *timingTrace {
+	return &timingTrace{start: time.Now()}
+}
+
+// Returns the hooks to be attached to the request context.
+func (tt *timingTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			tt.mark(&tt.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			tt.measure(&tt.dnsStart, &tt.timing.DNS)
+		},
+		ConnectStart: func(string, string) {
+			tt.mark(&tt.connStart)
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				tt.measure(&tt.connStart, &tt.timing.Connect)
+			}
+		},
+		TLSHandshakeStart: func() {
+			tt.mark(&tt.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			tt.measure(&tt.tlsStart, &tt.timing.TLS)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			tt.mark(&tt.wrote)
+		},
+		GotFirstResponseByte: func() {
+			tt.measure(&tt.wrote, &tt.timing.TTFB)
+		},
+	}
+}
+
+// Stops the recording and returns the result.
+func (tt *timingTrace) done() *Timing {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	timing := tt.timing
+	timing.Total = time.Since(tt.start)
+	return &timing
+}
+
+func (tt *timingTrace) mark(t *time.Time) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	*t = time.Now()
+}
+
+func (tt *timingTrace) measure(since *time.Time, d *time.Duration) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	*d = time.Since(*since)
+}
@@ -0,0 +1,105 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// TLS protocol implementation.
+type TLS struct {
+	Timeout time.Duration
+	// Optional. IP address family to use. Any by default.
+	Family Family
+	// Optional. Local end of the connections. The system chooses it by
+	// default.
+	Bind Bind
+	// Optional. Certificate authorities to trust. The system ones by default.
+	RootCAs *x509.CertPool
+}
+
+// String returns the identifier of the protocol.
+func (t *TLS) String() string {
+	return "tls"
+}
+
+// Probe makes a TLS handshake with a random HTTPS server.
+//
+// The target is a host:port.
+// The result includes the negotiated parameters and the details of the server
+// certificate. It is also returned if the certificate verification fails, to
+// help diagnosing interception.
+func (t *TLS) Probe(ctx context.Context, target string) (*Result, error) {
+	hostPort := target
+	if hostPort == "" {
+		var err error
+		hostPort, err = RandomTLSServer()
+		if err != nil {
+			return nil, fmt.Errorf("selecting TLS server: %w", err)
+		}
+	}
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, fmt.Errorf("parsing target: %w", err)
+	}
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	network := t.Family.network("tcp")
+	d := t.Bind.dialer(network, 0)
+	rawConn, err := d.DialContext(ctx, network, hostPort)
+	if err != nil {
+		return nil, err
+	}
+	defer rawConn.Close()
+	timing := &Timing{Connect: time.Since(start)}
+	// The verification is done later to report the certificate details even
+	// if it fails.
+	conn := tls.Client(rawConn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", "http/1.1"},
+	})
+	tlsStart := time.Now()
+	err = conn.HandshakeContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("handshake: %w", err)
+	}
+	timing.TLS = time.Since(tlsStart)
+	timing.Total = time.Since(start)
+	state := conn.ConnectionState()
+	res := &TLSResult{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+	}
+	result := &Result{Target: hostPort, TLS: res, Timing: timing}
+	if len(state.PeerCertificates) == 0 {
+		return result, errors.New("no server certificate")
+	}
+	leaf := state.PeerCertificates[0]
+	res.Subject = leaf.Subject.String()
+	res.Issuer = leaf.Issuer.String()
+	res.NotAfter = leaf.NotAfter
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         t.RootCAs,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		res.VerifyError = err.Error()
+		return result, fmt.Errorf("verifying certificate: %w", err)
+	}
+	return result, nil
+}
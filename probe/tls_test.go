@@ -0,0 +1,88 @@
+package probe
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTLSProbe(t *testing.T) {
+	tout := 1 * time.Second
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	hostPort := server.Listener.Addr().String()
+	t.Run(
+		"returns the handshake details if the certificate is trusted",
+		func(t *testing.T) {
+			roots := x509.NewCertPool()
+			roots.AddCert(server.Certificate())
+			proto := &TLS{Timeout: tout, RootCAs: roots}
+			res, err := proto.Probe(context.Background(), hostPort)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Target != hostPort {
+				t.Fatalf("got %q, want %q", res.Target, hostPort)
+			}
+			if res.TLS.Version != "TLS 1.3" {
+				t.Fatalf("got %q, want %q", res.TLS.Version, "TLS 1.3")
+			}
+			if res.TLS.CipherSuite == "" {
+				t.Fatal("got an empty cipher suite")
+			}
+			if res.TLS.ALPN != "h2" {
+				t.Fatalf("got %q, want %q", res.TLS.ALPN, "h2")
+			}
+			if res.TLS.Issuer != "O=Acme Co" {
+				t.Fatalf("got %q, want %q", res.TLS.Issuer, "O=Acme Co")
+			}
+			if !res.TLS.NotAfter.Equal(server.Certificate().NotAfter) {
+				t.Fatalf(
+					"got %s, want %s",
+					res.TLS.NotAfter, server.Certificate().NotAfter,
+				)
+			}
+			if res.TLS.VerifyError != "" {
+				t.Fatalf("got %q should be zero", res.TLS.VerifyError)
+			}
+			if res.Timing.TLS == 0 {
+				t.Fatalf("got %s, want > 0", res.Timing.TLS)
+			}
+		},
+	)
+	t.Run(
+		"returns the details and an error if the certificate is not trusted",
+		func(t *testing.T) {
+			proto := &TLS{Timeout: tout}
+			res, err := proto.Probe(context.Background(), hostPort)
+			if err == nil {
+				t.Fatal("got nil, want an error")
+			}
+			if !strings.HasPrefix(err.Error(), "verifying certificate: ") {
+				t.Fatalf("got %q, want a verification error", err)
+			}
+			if res.TLS.VerifyError == "" {
+				t.Fatal("got an empty verification error")
+			}
+			if res.TLS.Issuer != "O=Acme Co" {
+				t.Fatalf("got %q, want %q", res.TLS.Issuer, "O=Acme Co")
+			}
+		},
+	)
+	t.Run("returns an error if the target is invalid", func(t *testing.T) {
+		proto := &TLS{Timeout: tout}
+		res, err := proto.Probe(context.Background(), "127.0.0.1")
+		if err == nil {
+			t.Fatal("got nil, want an error")
+		}
+		if res != nil {
+			t.Fatalf("got %v should be nil", res)
+		}
+	})
+}
@@ -0,0 +1,206 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default maximum number of hops of a trace.
+const traceMaxHops = 30
+
+// First destination port of the UDP probes, increased with each hop.
+const tracePort = 33434
+
+// ErrNoReply is returned when no node answers a trace probe.
+var ErrNoReply = errors.New("no reply")
+
+// TraceProbe is a packet sent with a limited TTL to locate a hop.
+type TraceProbe struct {
+	// Type of packet: "udp", "tcp" or "icmp".
+	Method string
+	// Destination of the trace.
+	Dst net.IP
+	// Destination port, for UDP and TCP.
+	Port int
+	// Time to live, the number of the hop.
+	TTL int
+}
+
+// TraceNetwork sends the trace probes. It allows to replace the sockets, for
+// example in tests.
+type TraceNetwork interface {
+	// Hop sends the probe and waits for the answer of a node, returning its
+	// address and whether it is the destination.
+	Hop(ctx context.Context, p TraceProbe) (net.IP, bool, error)
+}
+
+// Trace protocol implementation, to locate where the connectivity breaks.
+//
+// Each attempt locates the next hop towards the target, starting again once
+// it is reached. So every hop is a report, and only the one of the
+// destination counts as a success (see Report.Status).
+type Trace struct {
+	Timeout time.Duration
+	// Optional. IP address family to use. IPv4 by default.
+	Family Family
+	// Optional. Type of packets to send: "udp" (default), "tcp" or "icmp".
+	Method string
+	// Optional. Maximum number of hops. 30 by default.
+	MaxHops int
+	// Optional. Network to send the probes. The system sockets by default,
+	// which require privileges to receive the ICMP messages of the hops.
+	Network TraceNetwork
+	mu      sync.Mutex
+	// Next TTL for each target.
+	ttls map[string]int
+	// Selected the first time to keep the same trace.
+	random string
+	// IPv6 address of the same server, if both families are traced.
+	randomIPv6 string
+}
+
+// String returns the identifier of the protocol.
+func (t *Trace) String() string {
+	return "trace"
+}
+
+// Probe locates the next hop towards a random public DNS server.
+//
+// The target is a host, or a host:port to set the destination port of UDP and
+// TCP probes (80 by default for TCP).
+// The result includes the hop number and the address of the node answering.
+// It is also returned if no node answers, wrapped in ErrNoReply.
+func (t *Trace) Probe(ctx context.Context, target string) (*Result, error) {
+	method := t.Method
+	if method == "" {
+		method = "udp"
+	}
+	port := 0
+	switch method {
+	case "udp":
+	case "tcp":
+		port = 80
+	case "icmp":
+	default:
+		return nil, fmt.Errorf("unsupported trace method: %s", method)
+	}
+	if target == "" {
+		var err error
+		target, err = t.randomTarget(method)
+		if err != nil {
+			return nil, fmt.Errorf("selecting DNS server: %w", err)
+		}
+	}
+	host := target
+	if h, p, err := net.SplitHostPort(target); err == nil {
+		host = h
+		port, err = strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("parsing target port: %w", err)
+		}
+	}
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	network := "ip4"
+	if t.Family == FamilyIPv6 {
+		network = "ip6"
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+	ttl := t.nextTTL(target)
+	if method == "udp" && port == 0 {
+		port = tracePort + ttl - 1
+	}
+	tn := t.Network
+	if tn == nil {
+		tn = systemTraceNetwork{}
+	}
+	addr, reached, err := tn.Hop(ctx, TraceProbe{
+		Method: method, Dst: ips[0], Port: port, TTL: ttl,
+	})
+	if ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, ctx.Err()
+	}
+	maxHops := t.MaxHops
+	if maxHops == 0 {
+		maxHops = traceMaxHops
+	}
+	if reached || ttl >= maxHops {
+		t.reset(target)
+	}
+	res := &TraceResult{Hop: ttl, Reached: reached}
+	if addr != nil {
+		res.Addr = addr.String()
+	}
+	result := &Result{Target: target, Trace: res}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return result, fmt.Errorf("hop %d: %w", ttl, ErrNoReply)
+	case err != nil:
+		return result, fmt.Errorf("hop %d: %w", ttl, err)
+	}
+	return result, nil
+}
+
+// Returns the target to use if none is set, the same for all the attempts.
+func (t *Trace) randomTarget(method string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.random != "" {
+		return t.random, nil
+	}
+	var err error
+	if method == "tcp" {
+		t.random, err = randomTCPServer(t.Family)
+	} else {
+		t.random, err = randomDNSServer(t.Family)
+	}
+	return t.random, err
+}
+
+// Returns the IPv4 and IPv6 addresses of the random target, to trace the same
+// server over both families.
+func (t *Trace) randomTargets() (string, string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.randomIPv6 != "" {
+		return t.random, t.randomIPv6, nil
+	}
+	v4, v6, err := randomDNSServers()
+	if err != nil {
+		return "", "", fmt.Errorf("selecting DNS server: %w", err)
+	}
+	if t.Method == "tcp" {
+		v4, v6 = net.JoinHostPort(v4, "53"), net.JoinHostPort(v6, "53")
+	}
+	t.random, t.randomIPv6 = v4, v6
+	return v4, v6, nil
+}
+
+// Returns the TTL to use in the next attempt against the target.
+func (t *Trace) nextTTL(target string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ttls == nil {
+		t.ttls = map[string]int{}
+	}
+	t.ttls[target]++
+	return t.ttls[target]
+}
+
+// Starts the trace to the target again.
+func (t *Trace) reset(target string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.ttls, target)
+}
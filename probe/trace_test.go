@@ -0,0 +1,202 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+)
+
+// Network for testing with a fixed route, the last hop is the destination.
+//
+// Hops with a nil address do not answer.
+type testTraceNetwork struct {
+	route []net.IP
+	mu    sync.Mutex
+	// Probes received.
+	probes []TraceProbe
+}
+
+func (n *testTraceNetwork) Hop(
+	ctx context.Context, p TraceProbe,
+) (net.IP, bool, error) {
+	n.mu.Lock()
+	n.probes = append(n.probes, p)
+	n.mu.Unlock()
+	addr := n.route[p.TTL-1]
+	if addr == nil {
+		<-ctx.Done()
+		return nil, false, ctx.Err()
+	}
+	return addr, p.TTL == len(n.route), nil
+}
+
+func TestTraceProbe(t *testing.T) {
+	tout := 1 * time.Second
+	t.Run("returns a hop on each attempt", func(t *testing.T) {
+		tn := &testTraceNetwork{route: []net.IP{
+			net.IPv4(192, 168, 1, 1), net.IPv4(10, 0, 0, 1), net.IPv4(1, 1, 1, 1),
+		}}
+		proto := &Trace{Timeout: tout, Network: tn}
+		want := []TraceResult{
+			{Hop: 1, Addr: "192.168.1.1"},
+			{Hop: 2, Addr: "10.0.0.1"},
+			{Hop: 3, Addr: "1.1.1.1", Reached: true},
+			// Starting again.
+			{Hop: 1, Addr: "192.168.1.1"},
+		}
+		for i, w := range want {
+			res, err := proto.Probe(context.Background(), "1.1.1.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Target != "1.1.1.1" {
+				t.Fatalf("got %q, want %q", res.Target, "1.1.1.1")
+			}
+			if *res.Trace != w {
+				t.Fatalf("got %+v, want %+v", *res.Trace, w)
+			}
+			p := tn.probes[i]
+			if p.Method != "udp" || p.Port != tracePort+w.Hop-1 {
+				t.Fatalf("got %+v, want an UDP probe to port %d", p, tracePort)
+			}
+		}
+		res, err := proto.Probe(context.Background(), "1.1.1.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Summary() != "hop=2 addr=10.0.0.1" {
+			t.Fatalf("got %q, want %q", res.Summary(), "hop=2 addr=10.0.0.1")
+		}
+	})
+	t.Run("uses the method and port of the target", func(t *testing.T) {
+		tn := &testTraceNetwork{route: []net.IP{net.IPv4(1, 1, 1, 1)}}
+		proto := &Trace{Timeout: tout, Method: "tcp", Network: tn}
+		res, err := proto.Probe(context.Background(), "1.1.1.1:53")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Summary() != "hop=1 addr=1.1.1.1 reached" {
+			t.Fatalf("got %q, want %q", res.Summary(), "hop=1 addr=1.1.1.1 reached")
+		}
+		p := tn.probes[0]
+		if p.Method != "tcp" || p.Port != 53 || !p.Dst.Equal(net.IPv4(1, 1, 1, 1)) {
+			t.Fatalf("got %+v, want a TCP probe to 1.1.1.1:53", p)
+		}
+	})
+	t.Run("returns the hop and an error if there is no reply", func(t *testing.T) {
+		tn := &testTraceNetwork{route: []net.IP{nil, net.IPv4(1, 1, 1, 1)}}
+		proto := &Trace{Timeout: 50 * time.Millisecond, Network: tn}
+		res, err := proto.Probe(context.Background(), "1.1.1.1")
+		if !errors.Is(err, ErrNoReply) {
+			t.Fatalf("got %v, want %v", err, ErrNoReply)
+		}
+		if err.Error() != "hop 1: no reply" {
+			t.Fatalf("got %q, want %q", err, "hop 1: no reply")
+		}
+		if res.Summary() != "hop=1 addr=*" {
+			t.Fatalf("got %q, want %q", res.Summary(), "hop=1 addr=*")
+		}
+		res, err = proto.Probe(context.Background(), "1.1.1.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Trace.Hop != 2 {
+			t.Fatalf("got %d, want %d", res.Trace.Hop, 2)
+		}
+	})
+	t.Run("starts again after the maximum hops", func(t *testing.T) {
+		tn := &testTraceNetwork{route: []net.IP{
+			net.IPv4(192, 168, 1, 1), net.IPv4(10, 0, 0, 1), net.IPv4(1, 1, 1, 1),
+		}}
+		proto := &Trace{Timeout: tout, MaxHops: 2, Network: tn}
+		for _, want := range []int{1, 2, 1} {
+			res, err := proto.Probe(context.Background(), "1.1.1.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Trace.Hop != want {
+				t.Fatalf("got %d, want %d", res.Trace.Hop, want)
+			}
+		}
+	})
+	t.Run("keeps the same random target", func(t *testing.T) {
+		tn := &testTraceNetwork{route: []net.IP{
+			net.IPv4(192, 168, 1, 1), net.IPv4(10, 0, 0, 1),
+		}}
+		proto := &Trace{Timeout: tout, Network: tn}
+		res, err := proto.Probe(context.Background(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := res.Target
+		res, err = proto.Probe(context.Background(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Target != target {
+			t.Fatalf("got %q, want %q", res.Target, target)
+		}
+		if res.Trace.Hop != 2 {
+			t.Fatalf("got %d, want %d", res.Trace.Hop, 2)
+		}
+	})
+	t.Run("returns an error if the method is unknown", func(t *testing.T) {
+		proto := &Trace{Timeout: tout, Method: "foo"}
+		_, err := proto.Probe(context.Background(), "1.1.1.1")
+		want := "unsupported trace method: foo"
+		if err == nil || err.Error() != want {
+			t.Fatalf("got %v, want %q", err, want)
+		}
+	})
+	t.Run("aborts the attempt if the context is cancelled", func(t *testing.T) {
+		tn := &testTraceNetwork{route: []net.IP{nil}}
+		proto := &Trace{Timeout: time.Minute, Network: tn}
+		_, err := proto.Probe(cancelSoon(t), "1.1.1.1")
+		assertCancelled(t, err)
+	})
+}
+
+func TestTraceProbeLoopback(t *testing.T) {
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		t.Skipf("raw ICMP sockets not allowed: %v", err)
+	}
+	conn.Close()
+	tout := 1 * time.Second
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listen.Close()
+	go func() {
+		for {
+			conn, err := listen.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	for method, target := range map[string]string{
+		"udp":  "127.0.0.1",
+		"tcp":  listen.Addr().String(),
+		"icmp": "127.0.0.1",
+	} {
+		t.Run("reaches the destination using "+method, func(t *testing.T) {
+			proto := &Trace{Timeout: tout, Method: method}
+			res, err := proto.Probe(context.Background(), target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := TraceResult{Hop: 1, Addr: "127.0.0.1", Reached: true}
+			if *res.Trace != want {
+				t.Fatalf("got %+v, want %+v", *res.Trace, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Transport protocol numbers, in the IP headers.
+const (
+	protocolTCP = 6
+	protocolUDP = 17
+)
+
+// Sends the trace probes using the system sockets.
+//
+// The ICMP messages of the hops are received with a raw socket, because the
+// unprivileged ones only get their own.
+type systemTraceNetwork struct{}
+
+// Matches the ICMP error messages with the probe which caused them, using the
+// IP packet they include.
+type traceMatcher func(proto int, dst net.IP, transport []byte) bool
+
+// Hop sends the probe and waits for the answer of a node.
+func (systemTraceNetwork) Hop(
+	ctx context.Context, p TraceProbe,
+) (net.IP, bool, error) {
+	// To stop the TCP handshakes.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	v6 := p.Dst.To4() == nil
+	network, addr, proto := "ip4:icmp", "0.0.0.0", protocolICMP
+	if v6 {
+		network, addr, proto = "ip6:ipv6-icmp", "::", protocolICMPv6
+	}
+	conn, err := icmp.ListenPacket(network, addr)
+	if err != nil {
+		return nil, false, fmt.Errorf("opening ICMP socket: %w", err)
+	}
+	defer conn.Close()
+	stop, err := closeOnDone(ctx, conn)
+	if err != nil {
+		return nil, false, err
+	}
+	defer stop()
+	// Answers of the destination which are not ICMP messages (TCP).
+	reachedCh := make(chan error, 1)
+	var match traceMatcher
+	var echo *icmp.Echo
+	switch p.Method {
+	case "udp":
+		match, err = sendTraceUDP(p, v6)
+	case "tcp":
+		match = sendTraceTCP(ctx, p, v6, reachedCh)
+	case "icmp":
+		echo = &icmp.Echo{
+			ID: os.Getpid() & 0xffff, Seq: p.TTL, Data: icmpPayload,
+		}
+		match, err = sendTraceICMP(conn, p, v6, echo)
+	default:
+		err = fmt.Errorf("unsupported trace method: %s", p.Method)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	type hop struct {
+		addr    net.IP
+		reached bool
+		err     error
+	}
+	hopCh := make(chan hop, 1)
+	go func() {
+		rb := make([]byte, 1500)
+		for {
+			n, peer, err := conn.ReadFrom(rb)
+			if err != nil {
+				hopCh <- hop{err: ctxErr(ctx, err)}
+				return
+			}
+			msg, err := icmp.ParseMessage(proto, rb[:n])
+			if err != nil {
+				continue
+			}
+			peerIP := net.ParseIP(addrIP(peer))
+			var data []byte
+			switch body := msg.Body.(type) {
+			case *icmp.Echo:
+				if echo != nil && body.ID == echo.ID && body.Seq == echo.Seq &&
+					(msg.Type == ipv4.ICMPTypeEchoReply ||
+						msg.Type == ipv6.ICMPTypeEchoReply) {
+					hopCh <- hop{addr: peerIP, reached: true}
+					return
+				}
+				continue
+			case *icmp.TimeExceeded:
+				data = body.Data
+			case *icmp.DstUnreach:
+				data = body.Data
+			default:
+				continue
+			}
+			innerProto, dst, transport, ok := parseInnerPacket(data, v6)
+			if !ok || !dst.Equal(p.Dst) || !match(innerProto, dst, transport) {
+				continue
+			}
+			if _, ok := msg.Body.(*icmp.TimeExceeded); ok {
+				hopCh <- hop{addr: peerIP}
+				return
+			}
+			if peerIP.Equal(p.Dst) {
+				hopCh <- hop{addr: peerIP, reached: true}
+				return
+			}
+			hopCh <- hop{addr: peerIP, err: errors.New("destination unreachable")}
+			return
+		}
+	}()
+	select {
+	case h := <-hopCh:
+		return h.addr, h.reached, h.err
+	case err := <-reachedCh:
+		if err != nil {
+			return nil, false, err
+		}
+		return p.Dst, true, nil
+	}
+}
+
+// Sends a UDP datagram with the TTL of the probe.
+func sendTraceUDP(p TraceProbe, v6 bool) (traceMatcher, error) {
+	network := "udp4"
+	if v6 {
+		network = "udp6"
+	}
+	conn, err := net.ListenPacket(network, "")
+	if err != nil {
+		return nil, fmt.Errorf("opening UDP socket: %w", err)
+	}
+	defer conn.Close()
+	if v6 {
+		err = ipv6.NewPacketConn(conn).SetHopLimit(p.TTL)
+	} else {
+		err = ipv4.NewPacketConn(conn).SetTTL(p.TTL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("setting TTL: %w", err)
+	}
+	_, err = conn.WriteTo(icmpPayload, &net.UDPAddr{IP: p.Dst, Port: p.Port})
+	if err != nil {
+		return nil, err
+	}
+	srcPort := conn.LocalAddr().(*net.UDPAddr).Port
+	return func(proto int, dst net.IP, transport []byte) bool {
+		return proto == protocolUDP && len(transport) >= 4 &&
+			int(binary.BigEndian.Uint16(transport)) == srcPort &&
+			int(binary.BigEndian.Uint16(transport[2:])) == p.Port
+	}, nil
+}
+
+// Starts a TCP handshake with the TTL of the probe.
+//
+// The destination answers the handshake, so the result is sent to the
+// channel: nil if it accepted or refused the connection.
+func sendTraceTCP(
+	ctx context.Context, p TraceProbe, v6 bool, reachedCh chan<- error,
+) traceMatcher {
+	d := net.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var err error
+			ctrlErr := c.Control(func(fd uintptr) {
+				err = setTTL(fd, v6, p.TTL)
+			})
+			return errors.Join(ctrlErr, err)
+		},
+	}
+	network := "tcp4"
+	if v6 {
+		network = "tcp6"
+	}
+	go func() {
+		addr := net.JoinHostPort(p.Dst.String(), fmt.Sprint(p.Port))
+		conn, err := d.DialContext(ctx, network, addr)
+		if err == nil {
+			conn.Close()
+			reachedCh <- nil
+			return
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			reachedCh <- nil
+		}
+		// The rest of the errors are waiting for the ICMP messages.
+	}()
+	// The source port is not known until the connection is made.
+	return func(proto int, dst net.IP, transport []byte) bool {
+		return proto == protocolTCP && len(transport) >= 4 &&
+			int(binary.BigEndian.Uint16(transport[2:])) == p.Port
+	}
+}
+
+// Sends an echo request with the TTL of the probe using the ICMP socket.
+func sendTraceICMP(
+	conn *icmp.PacketConn, p TraceProbe, v6 bool, echo *icmp.Echo,
+) (traceMatcher, error) {
+	req := icmp.Message{Type: ipv4.ICMPTypeEcho, Body: echo}
+	proto := protocolICMP
+	var err error
+	if v6 {
+		req.Type = ipv6.ICMPTypeEchoRequest
+		proto = protocolICMPv6
+		err = conn.IPv6PacketConn().SetHopLimit(p.TTL)
+	} else {
+		err = conn.IPv4PacketConn().SetTTL(p.TTL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("setting TTL: %w", err)
+	}
+	wb, err := req.Marshal(nil)
+	if err != nil {
+		return nil, fmt.Errorf("encoding echo request: %w", err)
+	}
+	_, err = conn.WriteTo(wb, &net.IPAddr{IP: p.Dst})
+	if err != nil {
+		return nil, err
+	}
+	return func(innerProto int, dst net.IP, transport []byte) bool {
+		return innerProto == proto && len(transport) >= 8 &&
+			int(binary.BigEndian.Uint16(transport[4:])) == echo.ID &&
+			int(binary.BigEndian.Uint16(transport[6:])) == echo.Seq
+	}, nil
+}
+
+// Returns the transport protocol, the destination and the transport header of
+// the IP packet included in an ICMP error message.
+func parseInnerPacket(data []byte, v6 bool) (int, net.IP, []byte, bool) {
+	if v6 {
+		// Extension headers are not expected in the probes.
+		if len(data) < ipv6.HeaderLen {
+			return 0, nil, nil, false
+		}
+		return int(data[6]), net.IP(data[24:40]), data[ipv6.HeaderLen:], true
+	}
+	if len(data) < ipv4.HeaderLen {
+		return 0, nil, nil, false
+	}
+	hl := int(data[0]&0x0f) * 4
+	if len(data) < hl {
+		return 0, nil, nil, false
+	}
+	return int(data[9]), net.IP(data[16:20]), data[hl:], true
+}
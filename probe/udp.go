@@ -0,0 +1,243 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Maximum size of a UDP datagram.
+const udpMaxSize = 1 << 16
+
+// Magic cookie of the STUN messages (RFC 5389, 6).
+const stunMagicCookie = 0x2112A442
+
+// Payload of the requests without a known service.
+var udpPayload = []byte("up\n")
+
+// A request a service answers to.
+type udpService struct {
+	// Returns a new request.
+	request func() ([]byte, error)
+	// Returns true if the datagram is the reply to the request.
+	isReply func(req, resp []byte) bool
+}
+
+// Built-in payloads, by name of the service.
+var udpServices = map[string]udpService{
+	"dns":  {dnsRequest, isDNSReply},
+	"ntp":  {ntpRequest, isNTPReply},
+	"stun": {stunRequest, isSTUNReply},
+}
+
+// Services listening on the well-known ports.
+var udpPorts = map[string]string{
+	"53":    "dns",
+	"123":   "ntp",
+	"3478":  "stun",
+	"19302": "stun",
+}
+
+// UDP protocol implementation.
+//
+// There is no handshake, so a payload the server answers to is sent to know it
+// is reachable.
+type UDP struct {
+	Timeout time.Duration
+	// Optional. IP address family to use. Any by default.
+	Family Family
+	// Optional. Local end of the connections. The system chooses it by
+	// default.
+	Bind Bind
+	// Optional. Built-in payload to send: "dns", "ntp" or "stun". The one of
+	// the service of the target port by default.
+	Service string
+	// Optional. Custom payload to send, any reply is valid. It takes
+	// precedence over the service. "up\n" if the port has no known service.
+	Payload []byte
+}
+
+// String returns the identifier of the protocol.
+func (u *UDP) String() string {
+	return "udp"
+}
+
+// Probe sends a STUN binding request to a random public server.
+//
+// The target is a host:port. A query for the root name servers (DNS), a
+// client request (NTP) or a binding request (STUN) is sent to the well-known
+// ports of these services, and only their replies are accepted.
+// The result includes the size of the reply and the time it took. Replies
+// equal to a custom payload are flagged as echoes.
+// The error wraps ErrNoReply if nothing is received in time.
+func (u *UDP) Probe(ctx context.Context, target string) (*Result, error) {
+	hostPort := target
+	if hostPort == "" {
+		var err error
+		hostPort, err = RandomSTUNServer()
+		if err != nil {
+			return nil, fmt.Errorf("selecting STUN server: %w", err)
+		}
+	}
+	_, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, fmt.Errorf("parsing target: %w", err)
+	}
+	name, service, err := u.service(port)
+	if err != nil {
+		return nil, err
+	}
+	req, err := service.request()
+	if err != nil {
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+	if u.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.Timeout)
+		defer cancel()
+	}
+	reply, err := udpExchange(
+		ctx, u.Bind, u.Family.network("udp"), hostPort, req, service.isReply,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Target: hostPort, UDP: &UDPResult{
+		Service:    name,
+		LocalAddr:  reply.localAddr,
+		RemoteAddr: reply.remoteAddr,
+		BytesSent:  len(req),
+		BytesRead:  len(reply.data),
+		RTT:        reply.received.Sub(reply.sent),
+		Echo:       name == "" && bytes.Equal(req, reply.data),
+	}}, nil
+}
+
+// Reply to a UDP request.
+type udpReply struct {
+	data       []byte
+	localAddr  string
+	remoteAddr string
+	// When the request was sent and the reply received.
+	sent     time.Time
+	received time.Time
+}
+
+// Sends the request to the server (host:port) and waits for its reply,
+// ignoring the unrelated packets, as spoofing attempts.
+//
+// The network is "udp", optionally restricted to a family (ie: "udp6").
+// The error wraps ErrNoReply if nothing is received in time.
+func udpExchange(
+	ctx context.Context, bind Bind, network, server string, req []byte,
+	isReply func(req, resp []byte) bool,
+) (*udpReply, error) {
+	conn, err := bind.dialer(network, 0).DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop, err := closeOnDone(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	sent := time.Now()
+	_, err = conn.Write(req)
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	buf := make([]byte, udpMaxSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			err = ctxErr(ctx, err)
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil, fmt.Errorf("%w: %w", ErrNoReply, err)
+			}
+			return nil, err
+		}
+		if !isReply(req, buf[:n]) {
+			continue
+		}
+		return &udpReply{
+			data:       buf[:n],
+			localAddr:  conn.LocalAddr().String(),
+			remoteAddr: conn.RemoteAddr().String(),
+			sent:       sent,
+			received:   time.Now(),
+		}, nil
+	}
+}
+
+// Returns the name of the service to send the payload of, empty for a custom
+// payload, which accepts any reply.
+func (u *UDP) service(port string) (string, udpService, error) {
+	custom := func(payload []byte) (string, udpService, error) {
+		return "", udpService{
+			request: func() ([]byte, error) { return payload, nil },
+			isReply: func(req, resp []byte) bool { return true },
+		}, nil
+	}
+	name := u.Service
+	switch {
+	case u.Payload != nil:
+		return custom(u.Payload)
+	case name == "":
+		name = udpPorts[port]
+		if name == "" {
+			return custom(udpPayload)
+		}
+	}
+	service, ok := udpServices[name]
+	if !ok {
+		return "", udpService{}, fmt.Errorf("unsupported UDP service: %s", name)
+	}
+	return name, service, nil
+}
+
+// Returns a query for the root name servers, which every resolver answers.
+func dnsRequest() ([]byte, error) {
+	query, err := newDNSQuery(".", dnsmessage.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+	return query.Pack()
+}
+
+// Checks the identifier and the response bit (RFC 1035, 4.1.1).
+func isDNSReply(req, resp []byte) bool {
+	return len(resp) >= 12 && bytes.Equal(req[:2], resp[:2]) &&
+		resp[2]&0x80 != 0
+}
+
+// Returns a STUN binding request (RFC 5389, 6) with a random transaction
+// identifier.
+func stunRequest() ([]byte, error) {
+	req := make([]byte, 20)
+	binary.BigEndian.PutUint16(req[0:], 0x0001)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	_, err := rand.Read(req[8:])
+	if err != nil {
+		return nil, fmt.Errorf(tmplRandom, err)
+	}
+	return req, nil
+}
+
+// Checks the binding response class (success or error) and the transaction
+// identifier.
+func isSTUNReply(req, resp []byte) bool {
+	if len(resp) < 20 {
+		return false
+	}
+	msgType := binary.BigEndian.Uint16(resp)
+	return (msgType == 0x0101 || msgType == 0x0111) &&
+		bytes.Equal(req[4:20], resp[4:20])
+}
@@ -0,0 +1,179 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Creates a UDP server for testing, sending the replies of the function to
+// each request. Returns its address.
+func newTestUDPServer(t *testing.T, reply func(req []byte) [][]byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("starting UDP server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, udpMaxSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, resp := range reply(buf[:n]) {
+				conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// Replies with the same datagram.
+func testEcho(req []byte) [][]byte {
+	return [][]byte{append([]byte{}, req...)}
+}
+
+// Replies as an SNTP server, after an unrelated packet.
+func testNTPResponse(req []byte) [][]byte {
+	resp := make([]byte, 48)
+	// Version 4, server mode (4).
+	resp[0] = 0x24
+	resp[1] = 2
+	copy(resp[24:32], req[40:48])
+	return [][]byte{make([]byte, 48), resp}
+}
+
+// Replies with a STUN binding success response, after an unrelated packet.
+func testSTUNResponse(req []byte) [][]byte {
+	resp := make([]byte, 20)
+	binary.BigEndian.PutUint16(resp, 0x0101)
+	copy(resp[4:20], req[4:20])
+	return [][]byte{[]byte("noise"), resp}
+}
+
+func TestUDPProbe(t *testing.T) {
+	tout := 1 * time.Second
+	t.Run("flags the reply to a custom payload as an echo", func(t *testing.T) {
+		addr := newTestUDPServer(t, testEcho)
+		proto := &UDP{Timeout: tout, Payload: []byte("ping")}
+		got, err := proto.Probe(context.Background(), addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.UDP.Echo || got.UDP.BytesRead != 4 || got.UDP.Service != "" {
+			t.Fatalf("got %+v, want an echo of 4 bytes", got.UDP)
+		}
+		if got.UDP.RemoteAddr != addr || got.Target != addr {
+			t.Fatalf("got %q, want %q", got.UDP.RemoteAddr, addr)
+		}
+	})
+	t.Run("accepts any reply to a custom payload", func(t *testing.T) {
+		addr := newTestUDPServer(t, func([]byte) [][]byte {
+			return [][]byte{[]byte("pong")}
+		})
+		proto := &UDP{Timeout: tout}
+		got, err := proto.Probe(context.Background(), addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UDP.Echo || got.UDP.BytesSent != len(udpPayload) {
+			t.Fatalf("got %+v, want the default payload, not echoed", got.UDP)
+		}
+	})
+	for _, tt := range []struct {
+		service string
+		reply   func([]byte) [][]byte
+	}{
+		{"ntp", testNTPResponse},
+		{"stun", testSTUNResponse},
+	} {
+		t.Run("accepts only the reply to the "+tt.service+" payload",
+			func(t *testing.T) {
+				addr := newTestUDPServer(t, tt.reply)
+				proto := &UDP{Timeout: tout, Service: tt.service}
+				got, err := proto.Probe(context.Background(), addr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.UDP.Service != tt.service {
+					t.Fatalf("got %q, want %q", got.UDP.Service, tt.service)
+				}
+				want := tt.reply(make([]byte, 48))[1]
+				if got.UDP.BytesRead != len(want) {
+					t.Fatalf("got %d, want %d", got.UDP.BytesRead, len(want))
+				}
+			},
+		)
+	}
+	t.Run("accepts only the reply to the dns payload", func(t *testing.T) {
+		srv := newTestDNSServer(t)
+		proto := &UDP{Timeout: tout, Service: "dns"}
+		got, err := proto.Probe(context.Background(), srv.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UDP.Service != "dns" {
+			t.Fatalf("got %q, want %q", got.UDP.Service, "dns")
+		}
+	})
+	t.Run("chooses the payload by the port", func(t *testing.T) {
+		proto := &UDP{}
+		for port, want := range map[string]string{
+			"53": "dns", "123": "ntp", "3478": "stun", "19302": "stun", "7": "",
+		} {
+			got, _, err := proto.service(port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		}
+	})
+	t.Run("returns an error if nothing is received", func(t *testing.T) {
+		addr := newTestUDPServer(t, func([]byte) [][]byte { return nil })
+		proto := &UDP{Timeout: 100 * time.Millisecond}
+		_, err := proto.Probe(context.Background(), addr)
+		if !errors.Is(err, ErrNoReply) {
+			t.Fatalf("got %v, want %v", err, ErrNoReply)
+		}
+	})
+	t.Run("returns an error if the service is unknown", func(t *testing.T) {
+		proto := &UDP{Timeout: tout, Service: "foo"}
+		_, err := proto.Probe(context.Background(), "127.0.0.1:7")
+		want := "unsupported UDP service: foo"
+		if err == nil || err.Error() != want {
+			t.Fatalf("got %v, want %q", err, want)
+		}
+	})
+	t.Run("returns an error if the target lacks the port", func(t *testing.T) {
+		proto := &UDP{Timeout: tout}
+		_, err := proto.Probe(context.Background(), "127.0.0.1")
+		if err == nil || !strings.HasPrefix(err.Error(), "parsing target") {
+			t.Fatalf("got %v, want a parsing error", err)
+		}
+	})
+	t.Run("aborts the attempt if the context is cancelled", func(t *testing.T) {
+		addr := newTestUDPServer(t, func([]byte) [][]byte { return nil })
+		proto := &UDP{Timeout: time.Minute}
+		_, err := proto.Probe(cancelSoon(t), addr)
+		assertCancelled(t, err)
+	})
+}
+
+func TestRandomSTUNServer(t *testing.T) {
+	got, err := RandomSTUNServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = net.SplitHostPort(got)
+	if err != nil {
+		t.Fatalf("invalid host/port: %s", got)
+	}
+}
@@ -0,0 +1,273 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Uptime is the availability of a protocol and target over a period, from
+// the records of the history.
+type Uptime struct {
+	// Name of the check, if any.
+	Check string `json:"check,omitempty"`
+	// Network interface used, if bound to one.
+	Interface string `json:"interface,omitempty"`
+	// Protocol used to connect to.
+	ProtocolID string `json:"protocol"`
+	// Target used to connect to. "random" for the public servers chosen by
+	// the protocol.
+	Target string `json:"target"`
+	// Times of the first and last records.
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Number of attempts.
+	Sent int `json:"sent"`
+	// Number of successful attempts.
+	Received int `json:"received"`
+	// Percentage of successful attempts.
+	Uptime float64 `json:"uptime"`
+	// Periods with failed attempts, in order.
+	Outages []Outage `json:"outages,omitempty"`
+	// Response times of the successful attempts over time.
+	Latency []LatencyPoint `json:"latency,omitempty"`
+}
+
+// Outage is a period with failed attempts.
+type Outage struct {
+	// Time of the first failed attempt.
+	Start time.Time `json:"start"`
+	// Time of the next successful attempt. Zero if the outage is ongoing.
+	End time.Time `json:"end"`
+	// Until the end, or the last attempt if it is ongoing.
+	Duration time.Duration `json:"duration"`
+	// Error of the first failed attempt.
+	Error string `json:"error"`
+}
+
+// LatencyPoint aggregates the response times of a period.
+type LatencyPoint struct {
+	// Start of the period.
+	Time time.Time `json:"time"`
+	// Number of successful attempts.
+	Count int           `json:"count"`
+	Avg   time.Duration `json:"avg"`
+	Max   time.Duration `json:"max"`
+}
+
+// Uptimes is the availability of each protocol and target in the history.
+type Uptimes []*Uptime
+
+// NewUptimes aggregates the records for each check, interface, protocol and
+// target, in order of appearance. The latency is grouped in periods of the
+// step.
+//
+// The records must be sorted by time.
+func NewUptimes(records []HistoryRecord, step time.Duration) Uptimes {
+	var uptimes Uptimes
+	byKey := map[monitorKey]*Uptime{}
+	for _, r := range records {
+		target := r.groupTarget()
+		key := monitorKey{r.Check, r.Interface, r.ProtocolID, target}
+		u, ok := byKey[key]
+		if !ok {
+			u = &Uptime{
+				Check: r.Check, Interface: r.Interface, ProtocolID: r.ProtocolID,
+				Target: target, From: r.At,
+			}
+			byKey[key] = u
+			uptimes = append(uptimes, u)
+		}
+		u.add(&r, step)
+	}
+	for _, u := range uptimes {
+		u.Uptime = 100 * float64(u.Received) / float64(u.Sent)
+		if n := len(u.Outages); n > 0 && u.Outages[n-1].End.IsZero() {
+			u.Outages[n-1].Duration = u.To.Sub(u.Outages[n-1].Start)
+		}
+	}
+	return uptimes
+}
+
+// Includes a new record.
+func (u *Uptime) add(r *HistoryRecord, step time.Duration) {
+	u.To = r.At
+	u.Sent++
+	ongoing := len(u.Outages) > 0 && u.Outages[len(u.Outages)-1].End.IsZero()
+	if !r.Succeeded() {
+		if !ongoing {
+			u.Outages = append(u.Outages, Outage{Start: r.At, Error: r.Error})
+		}
+		return
+	}
+	u.Received++
+	if ongoing {
+		o := &u.Outages[len(u.Outages)-1]
+		o.End = r.At
+		o.Duration = o.End.Sub(o.Start)
+	}
+	at := r.At
+	if step > 0 {
+		at = at.Truncate(step)
+	}
+	n := len(u.Latency)
+	if n == 0 || !u.Latency[n-1].Time.Equal(at) {
+		u.Latency = append(u.Latency, LatencyPoint{Time: at})
+		n++
+	}
+	p := &u.Latency[n-1]
+	p.Avg = (p.Avg*time.Duration(p.Count) + r.Time) / time.Duration(p.Count+1)
+	p.Count++
+	p.Max = max(p.Max, r.Time)
+}
+
+// Returns the protocol followed by the interface, if any.
+func (u *Uptime) protocol() string {
+	return withInterface(u.ProtocolID, u.Interface)
+}
+
+// String returns the availability ready to be printed.
+func (us Uptimes) String(format Format) (string, error) {
+	switch format {
+	case HumanFormat:
+		return us.stringHuman(), nil
+	case JSONFormat:
+		out, err := json.Marshal(struct {
+			History Uptimes `json:"history"`
+		}{us})
+		if err != nil {
+			return "", fmt.Errorf("marshaling history: %w", err)
+		}
+		return string(out), nil
+	case GrepFormat:
+		return us.stringGrep(), nil
+	default:
+		return "", fmt.Errorf("unsupported format: %v", format)
+	}
+}
+
+// Returns the availability in human readable format, as tables.
+// Example:
+// --- uptime ---
+// PROTOCOL  TARGET      FROM                  TO                    SENT  RECEIVED  UPTIME  OUTAGES
+// tcp       1.1.1.1:53  2024-01-02T15:04:05Z  2024-01-02T16:04:05Z  120   118       98.3%   1
+// --- outages ---
+// PROTOCOL  TARGET      START                 END                   DURATION  ERROR
+// tcp       1.1.1.1:53  2024-01-02T15:30:05Z  2024-01-02T15:31:05Z  1m0s      i/o timeout
+// --- latency ---
+// PROTOCOL  TARGET      TIME                  COUNT  AVG   MAX
+// tcp       1.1.1.1:53  2024-01-02T15:00:00Z  55     12ms  40ms
+//
+// The name of the check is included as the first column, if any, and the
+// interface follows the protocol. Example: 'tcp@eth0'.
+func (us Uptimes) stringHuman() string {
+	withChecks := slices.ContainsFunc(us, func(u *Uptime) bool {
+		return u.Check != ""
+	})
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	// Writes the header or a row, including the check column if needed.
+	row := func(check string, format string, a ...any) {
+		if withChecks {
+			fmt.Fprintf(w, "%s\t", check)
+		}
+		fmt.Fprintf(w, format+"\n", a...)
+	}
+	table := func(title, header string) {
+		w.Flush()
+		buf.WriteString(bold(title) + "\n")
+		row("CHECK", header)
+	}
+	table(
+		"--- uptime ---",
+		"PROTOCOL\tTARGET\tFROM\tTO\tSENT\tRECEIVED\tUPTIME\tOUTAGES",
+	)
+	for _, u := range us {
+		row(
+			u.Check, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%d",
+			u.protocol(), u.Target, formatTime(u.From), formatTime(u.To),
+			u.Sent, u.Received, formatLoss(u.Uptime), len(u.Outages),
+		)
+	}
+	hasOutages := func(u *Uptime) bool { return len(u.Outages) > 0 }
+	if slices.ContainsFunc(us, hasOutages) {
+		table("--- outages ---", "PROTOCOL\tTARGET\tSTART\tEND\tDURATION\tERROR")
+		for _, u := range us {
+			for _, o := range u.Outages {
+				row(
+					u.Check, "%s\t%s\t%s\t%s\t%s\t%s",
+					u.protocol(), u.Target, formatTime(o.Start), formatEnd(o.End),
+					o.Duration, red(o.Error),
+				)
+			}
+		}
+	}
+	hasLatency := func(u *Uptime) bool { return len(u.Latency) > 0 }
+	if slices.ContainsFunc(us, hasLatency) {
+		table("--- latency ---", "PROTOCOL\tTARGET\tTIME\tCOUNT\tAVG\tMAX")
+		for _, u := range us {
+			for _, p := range u.Latency {
+				row(
+					u.Check, "%s\t%s\t%s\t%d\t%s\t%s",
+					u.protocol(), u.Target, formatTime(p.Time), p.Count, p.Avg,
+					p.Max,
+				)
+			}
+		}
+	}
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Returns the availability in a grepable format, one line for each protocol
+// and target, outage and latency point.
+//
+// Examples:
+// 'uptime	tcp	1.1.1.1:53	2024-01-02T15:04:05Z	2024-01-02T16:04:05Z	120	118	98.3%	1'
+// 'outage	tcp	1.1.1.1:53	2024-01-02T15:30:05Z	2024-01-02T15:31:05Z	1m0s	i/o timeout'
+// 'latency	tcp	1.1.1.1:53	2024-01-02T15:00:00Z	55	12ms	40ms'
+// The end of an ongoing outage is 'ongoing'. The interface and the check are
+// appended, if any. Example: 'check=portal'.
+func (us Uptimes) stringGrep() string {
+	var lines []string
+	add := func(u *Uptime, line string) {
+		lines = append(lines, withLabels(line, u.Interface, u.Check))
+	}
+	for _, u := range us {
+		add(u, fmt.Sprintf(
+			"uptime\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%d",
+			u.ProtocolID, u.Target, formatTime(u.From), formatTime(u.To),
+			u.Sent, u.Received, formatLoss(u.Uptime), len(u.Outages),
+		))
+		for _, o := range u.Outages {
+			add(u, fmt.Sprintf(
+				"outage\t%s\t%s\t%s\t%s\t%s\t%s",
+				u.ProtocolID, u.Target, formatTime(o.Start), formatEnd(o.End),
+				o.Duration, o.Error,
+			))
+		}
+		for _, p := range u.Latency {
+			add(u, fmt.Sprintf(
+				"latency\t%s\t%s\t%s\t%d\t%s\t%s",
+				u.ProtocolID, u.Target, formatTime(p.Time), p.Count, p.Avg, p.Max,
+			))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Returns the end of an outage, 'ongoing' if it is zero.
+func formatEnd(t time.Time) string {
+	if t.IsZero() {
+		return "ongoing"
+	}
+	return formatTime(t)
+}
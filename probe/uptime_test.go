@@ -0,0 +1,154 @@
+package probe
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestUptimes() Uptimes {
+	start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	var records []HistoryRecord
+	for i, r := range []Report{
+		{ProtocolID: "tcp", Target: "1.1.1.1:53", Time: 10 * time.Millisecond},
+		{ProtocolID: "tcp", Target: "1.1.1.1:53", Error: "timeout"},
+		{ProtocolID: "dns", Target: "example.com", Error: "refused"},
+		{ProtocolID: "tcp", Target: "1.1.1.1:53", Error: "refused"},
+		{ProtocolID: "tcp", Target: "1.1.1.1:53", Time: 30 * time.Millisecond},
+		{ProtocolID: "tcp", Target: "1.1.1.1:53", Time: 20 * time.Millisecond},
+	} {
+		records = append(records, HistoryRecord{
+			At: start.Add(time.Duration(i) * 20 * time.Minute), Report: r,
+		})
+	}
+	return NewUptimes(records, time.Hour)
+}
+
+func TestNewUptimes(t *testing.T) {
+	got := newTestUptimes()
+	if len(got) != 2 {
+		t.Fatalf("got %d uptimes, want 2", len(got))
+	}
+	tcp, dns := got[0], got[1]
+	t.Run("returns the ratio of successful attempts", func(t *testing.T) {
+		if tcp.Sent != 5 || tcp.Received != 3 || tcp.Uptime != 60 {
+			t.Fatalf("got %+v, want 3/5 (60%%)", tcp)
+		}
+		if dns.Sent != 1 || dns.Uptime != 0 {
+			t.Fatalf("got %+v, want 0/1 (0%%)", dns)
+		}
+	})
+	t.Run("returns the outages", func(t *testing.T) {
+		if len(tcp.Outages) != 1 {
+			t.Fatalf("got %+v, want 1 outage", tcp.Outages)
+		}
+		o := tcp.Outages[0]
+		if o.Duration != time.Hour || o.Error != "timeout" {
+			t.Fatalf("got %+v, want 1h0m0s with the first error", o)
+		}
+	})
+	t.Run("returns the ongoing outages", func(t *testing.T) {
+		if len(dns.Outages) != 1 || !dns.Outages[0].End.IsZero() {
+			t.Fatalf("got %+v, want an ongoing outage", dns.Outages)
+		}
+	})
+	t.Run("aggregates the random targets", func(t *testing.T) {
+		at := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+		got := NewUptimes([]HistoryRecord{
+			{At: at, Report: Report{
+				ProtocolID: "tcp", Target: "1.1.1.1:53", RandomTarget: true,
+			}},
+			{At: at.Add(time.Minute), Report: Report{
+				ProtocolID: "tcp", RandomTarget: true, Error: "timeout",
+			}},
+			{At: at.Add(2 * time.Minute), Report: Report{
+				ProtocolID: "tcp", Target: "8.8.8.8:53", RandomTarget: true,
+			}},
+		}, time.Hour)
+		if len(got) != 1 || got[0].Target != "random" || got[0].Sent != 3 {
+			t.Fatalf("got %+v, want a single random target", got)
+		}
+		if len(got[0].Outages) != 1 || got[0].Outages[0].End.IsZero() {
+			t.Fatalf("got %+v, want the outage ended", got[0].Outages)
+		}
+	})
+	t.Run("returns the latency of each period", func(t *testing.T) {
+		want := []LatencyPoint{
+			{
+				Time:  time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC),
+				Count: 1, Avg: 10 * time.Millisecond, Max: 10 * time.Millisecond,
+			},
+			{
+				Time:  time.Date(2024, 1, 2, 16, 0, 0, 0, time.UTC),
+				Count: 2, Avg: 25 * time.Millisecond, Max: 30 * time.Millisecond,
+			},
+		}
+		if len(tcp.Latency) != len(want) {
+			t.Fatalf("got %+v, want %+v", tcp.Latency, want)
+		}
+		for i := range want {
+			if tcp.Latency[i] != want[i] {
+				t.Fatalf("got %+v, want %+v", tcp.Latency[i], want[i])
+			}
+		}
+	})
+}
+
+func TestUptimesString(t *testing.T) {
+	uptimes := newTestUptimes()
+	t.Run("returns the human format", func(t *testing.T) {
+		got, err := uptimes.String(HumanFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{
+			"--- uptime ---", "--- outages ---", "--- latency ---",
+			"60%", "ongoing", "25ms",
+		} {
+			if !strings.Contains(got, want) {
+				t.Fatalf("got %q, want %q in it", got, want)
+			}
+		}
+	})
+	t.Run("returns the JSON format", func(t *testing.T) {
+		got, err := uptimes.String(JSONFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out struct{ History []Uptime }
+		err = json.Unmarshal([]byte(got), &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out.History) != 2 || out.History[0].Uptime != 60 {
+			t.Fatalf("got %+v, want the uptimes", out)
+		}
+	})
+	t.Run("returns the grep format", func(t *testing.T) {
+		got, err := uptimes.String(GrepFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(got, "\n")
+		want := "uptime\ttcp\t1.1.1.1:53\t2024-01-02T15:00:00Z\t" +
+			"2024-01-02T16:40:00Z\t5\t3\t60%\t1"
+		if lines[0] != want {
+			t.Fatalf("got %q, want %q", lines[0], want)
+		}
+		want = "outage\ttcp\t1.1.1.1:53\t2024-01-02T15:20:00Z\t" +
+			"2024-01-02T16:20:00Z\t1h0m0s\ttimeout"
+		if lines[1] != want {
+			t.Fatalf("got %q, want %q", lines[1], want)
+		}
+		if len(lines) != 6 {
+			t.Fatalf("got %d lines, want 6", len(lines))
+		}
+	})
+	t.Run("returns an error if the format is unknown", func(t *testing.T) {
+		_, err := uptimes.String(Format(99))
+		if err == nil {
+			t.Fatal("got nil, want an error")
+		}
+	})
+}